@@ -0,0 +1,376 @@
+package alertmanager
+
+import (
+	"blabber/bot"
+	"blabber/incident"
+	"blabber/web"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Author of the changes made to incidents because of alerts.
+const Author = "alertmanager"
+
+// Actions that can be taken on alerts.
+const (
+	ActionAnnounce = "announce"
+	ActionIncident = "incident"
+)
+
+// Alert is a single alert, as sent by Alertmanager.
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Message is the body of the Alertmanager webhook requests.
+type Message struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []*Alert          `json:"alerts"`
+}
+
+// IsFiring tells you if the alert is firing or resolved.
+func (a *Alert) IsFiring() bool {
+	return a.Status == "firing"
+}
+
+// String formats the alert as a single line, suitable for IRC.
+func (a *Alert) String() string {
+	name := a.Labels["alertname"]
+	var labels []string
+	for k, v := range a.Labels {
+		if k != "alertname" {
+			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	sort.Strings(labels)
+	desc := a.Annotations["summary"]
+	if desc == "" {
+		desc = a.Annotations["description"]
+	}
+	line := fmt.Sprintf("[%s] %s", strings.ToUpper(a.Status), name)
+	if desc != "" {
+		line += ": " + desc
+	}
+	if len(labels) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(labels, ", "))
+	}
+	return line
+}
+
+// Key identifies the alert. Alertmanager sends a fingerprint, but older versions don't,
+// and then the alert is identified by its labels.
+func (a *Alert) Key() string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	var labels []string
+	for k, v := range a.Labels {
+		labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(labels)
+	return fmt.Sprintf("labels:%x", sha256.Sum256([]byte(strings.Join(labels, "\n"))))
+}
+
+// Matches tells you if the alert matches the labels of a rule.
+func Matches(rule bot.AlertRule, a *Alert) bool {
+	for label, value := range rule.Match {
+		if a.Labels[label] != value {
+			return false
+		}
+	}
+	for label, expr := range rule.MatchRe {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			log.Error("Invalid regular expression in alert rule", "label", label, "expression", expr, "error", err)
+			return false
+		}
+		if !re.MatchString(a.Labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// findRule returns the first rule matching the alert, or nil.
+func findRule(c *bot.Configuration, a *Alert) *bot.AlertRule {
+	for n := range c.Alertmanager.Rules {
+		if Matches(c.Alertmanager.Rules[n], a) {
+			return &c.Alertmanager.Rules[n]
+		}
+	}
+	return nil
+}
+
+// Receiver handles the webhooks sent by Alertmanager.
+type Receiver struct {
+	irc    *hbot.Bot
+	db     *sql.DB
+	config *bot.Configuration
+}
+
+// NewReceiver returns a new Alertmanager receiver, after checking its rules.
+func NewReceiver(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) (*Receiver, error) {
+	for n, rule := range c.Alertmanager.Rules {
+		if err := validateRule(db, c, rule); err != nil {
+			return nil, fmt.Errorf("Invalid alert rule %d: %v", n+1, err)
+		}
+	}
+	return &Receiver{irc: irc, db: db, config: c}, nil
+}
+
+// validateRule checks that the incidents opened by a rule can actually be created.
+func validateRule(db *sql.DB, c *bot.Configuration, rule bot.AlertRule) error {
+	for label, expr := range rule.MatchRe {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("Invalid regular expression for %s: %v", label, err)
+		}
+	}
+	switch rule.Action {
+	case ActionAnnounce:
+		return nil
+	case ActionIncident:
+		if !incident.ValidSeverity(rule.Severity) {
+			return fmt.Errorf("Severity must be between 1 and 5")
+		}
+		_, err := incident.LookupComponent(db, c, rule.Component)
+		return err
+	default:
+		return fmt.Errorf("Unknown action '%s'", rule.Action)
+	}
+}
+
+// Register adds the Alertmanager endpoint to the HTTP server.
+func (r *Receiver) Register(server *web.Server) {
+	server.Handle("/alertmanager", r)
+}
+
+// ServeHTTP handles a webhook request.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if token := r.config.Alertmanager.Token; token != "" {
+		given := []byte(req.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(given, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	var msg Message
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		http.Error(w, "Could not parse the request body", http.StatusBadRequest)
+		return
+	}
+	failed := 0
+	for _, alert := range msg.Alerts {
+		if err := r.Handle(alert); err != nil {
+			log.Error("Could not handle the alert", "alert", alert.Labels["alertname"], "error", err)
+			failed++
+		}
+	}
+	// Alertmanager retries the notifications that fail with a 5xx status.
+	if failed > 0 {
+		http.Error(w, fmt.Sprintf("Could not handle %d of %d alerts", failed, len(msg.Alerts)), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Handle routes a single alert according to the rules.
+func (r *Receiver) Handle(a *Alert) error {
+	rule := findRule(r.config, a)
+	if rule == nil {
+		return nil
+	}
+	switch rule.Action {
+	case ActionAnnounce:
+		r.announce(a.String())
+		return nil
+	case ActionIncident:
+		// The IRC commands may update the same incidents at the same time.
+		incident.LockIncidents()
+		defer incident.UnlockIncidents()
+		if a.IsFiring() {
+			return r.fire(rule, a)
+		}
+		return r.resolve(rule, a)
+	default:
+		return fmt.Errorf("Unknown action '%s' in alert rule", rule.Action)
+	}
+}
+
+// announce sends a message to the configured channels.
+func (r *Receiver) announce(text string) {
+	channels := r.config.Alertmanager.Channels
+	if len(channels) == 0 {
+		channels = r.config.Channels
+	}
+	for _, channel := range channels {
+		r.irc.Msg(channel, text)
+	}
+}
+
+// fire opens an incident for the alert, or adds the alert to the timeline of
+// an open incident for the same component.
+func (r *Receiver) fire(rule *bot.AlertRule, a *Alert) error {
+	inc, err := getAlertIncident(r.db, a.Key())
+	if err != nil {
+		return err
+	}
+	// Alertmanager sends the same alerts again until they're resolved.
+	if inc != nil && inc.Status != incident.StatusClosed {
+		return nil
+	}
+	if inc, err = findOpenIncident(r.db, r.config, rule.Component); err != nil {
+		return err
+	}
+	isNew := inc == nil
+	if isNew {
+		if inc, err = incident.NewIncident(rule.Severity, []string{rule.Component}, r.config, r.db); err != nil {
+			return err
+		}
+		inc.AddEvent(incident.EventStart, Author, fmt.Sprintf("severity %d, affecting %s", rule.Severity, strings.Join(inc.Components(), ", ")))
+	} else if incident.ValidSeverity(rule.Severity) && incident.IsWorseSeverity(rule.Severity, inc.Severity()) {
+		inc.SetSeverity(rule.Severity, Author)
+	}
+	inc.AddEvent(incident.EventAlert, Author, a.String())
+	// Alertmanager retries when publishing fails: the alert must be recorded
+	// first, not to add it to the timeline again.
+	if err := r.record(inc, a.Key()); err != nil {
+		return err
+	}
+	if err := r.publish(inc); err != nil {
+		return err
+	}
+	if isNew {
+		r.announce(fmt.Sprintf("Incident opened from alert: %s", inc.Summary(false)))
+	}
+	r.announce(fmt.Sprintf("%s (incident #%d)", a.String(), inc.ID))
+	return nil
+}
+
+// resolve adds a note to the timeline of the incident opened for the alert.
+func (r *Receiver) resolve(rule *bot.AlertRule, a *Alert) error {
+	inc, err := getAlertIncident(r.db, a.Key())
+	if err != nil || inc == nil {
+		return err
+	}
+	if err := deleteAlertIncident(r.db, a.Key()); err != nil {
+		return err
+	}
+	if inc.Status == incident.StatusClosed {
+		return nil
+	}
+	inc.AddEvent(incident.EventAlert, Author, a.String())
+	if err := r.publish(inc); err != nil {
+		return err
+	}
+	r.announce(fmt.Sprintf("%s (incident #%d)", a.String(), inc.ID))
+	if rule.SuggestClose {
+		r.announce(fmt.Sprintf("If incident %d is over, close it with !incident_close %d", inc.ID, inc.ID))
+	}
+	return nil
+}
+
+// record saves the incident along with the alert it was opened or annotated for.
+func (r *Receiver) record(inc *incident.Incident, key string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := inc.Save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := saveAlertIncident(tx, key, inc.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Receiver) publish(inc *incident.Incident) error {
+	failed, err := inc.Publish(r.irc, r.db, r.config)
+	if len(failed) > 0 {
+		log.Error("Could not update the topic", "channels", strings.Join(failed, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	return inc.OpenChannel(r.irc, r.db, r.config, nil)
+}
+
+// findOpenIncident returns an open incident affecting the component, if any.
+func findOpenIncident(db *sql.DB, c *bot.Configuration, component string) (*incident.Incident, error) {
+	comp, err := incident.LookupComponent(db, c, component)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := incident.GetOpenIncidents(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, inc := range incidents {
+		for _, name := range inc.Components() {
+			if name == comp.Name {
+				return inc, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Persistence of the incidents opened or annotated for each alert.
+func getAlertIncident(db *sql.DB, fingerprint string) (*incident.Incident, error) {
+	var id int64
+	err := db.QueryRow("SELECT incident_id FROM alert_incidents WHERE fingerprint = ?", fingerprint).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return incident.GetByID(db, id)
+}
+
+func saveAlertIncident(db incident.Querier, fingerprint string, incidentID int64) error {
+	statement, err := db.Prepare("INSERT OR REPLACE INTO alert_incidents (fingerprint, incident_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(fingerprint, incidentID)
+	return err
+}
+
+func deleteAlertIncident(db *sql.DB, fingerprint string) error {
+	statement, err := db.Prepare("DELETE FROM alert_incidents WHERE fingerprint = ?")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(fingerprint)
+	return err
+}
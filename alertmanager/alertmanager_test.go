@@ -0,0 +1,220 @@
+package alertmanager
+
+import (
+	"blabber/bot"
+	"blabber/incident"
+	"blabber/webhook"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	schema, err := ioutil.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to an in-memory database gets its own database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(string(schema)); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b *Alert
+		same bool
+	}{
+		{
+			&Alert{Fingerprint: "abc", Labels: map[string]string{"alertname": "Down"}},
+			&Alert{Fingerprint: "abc", Labels: map[string]string{"alertname": "Up"}},
+			true,
+		},
+		{
+			&Alert{Labels: map[string]string{"alertname": "Down", "instance": "db1", "job": "db"}},
+			&Alert{Labels: map[string]string{"job": "db", "instance": "db1", "alertname": "Down"}},
+			true,
+		},
+		{
+			&Alert{Labels: map[string]string{"alertname": "Down", "instance": "db1"}},
+			&Alert{Labels: map[string]string{"alertname": "Down", "instance": "db2"}},
+			false,
+		},
+		{
+			&Alert{Labels: map[string]string{"alertname": "Down"}},
+			&Alert{Labels: map[string]string{}},
+			false,
+		},
+	}
+	for _, test := range tests {
+		if test.a.Key() == "" {
+			t.Errorf("empty key for %v", test.a.Labels)
+		}
+		if same := test.a.Key() == test.b.Key(); same != test.same {
+			t.Errorf("keys of %v and %v: got same %v, want %v", test.a.Labels, test.b.Labels, same, test.same)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	rule := bot.AlertRule{
+		Match:   map[string]string{"job": "db"},
+		MatchRe: map[string]string{"instance": "db[0-9]+"},
+	}
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"job": "db", "instance": "db1"}, true},
+		{map[string]string{"job": "db", "instance": "db12"}, true},
+		{map[string]string{"job": "db", "instance": "db1.example.com"}, false},
+		{map[string]string{"job": "web", "instance": "db1"}, false},
+		{map[string]string{"instance": "db1"}, false},
+	}
+	for _, test := range tests {
+		if got := Matches(rule, &Alert{Labels: test.labels}); got != test.want {
+			t.Errorf("Matches(%v) = %v, want %v", test.labels, got, test.want)
+		}
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	db := newTestDB(t)
+	events := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(webhook.EventHeader)
+	}))
+	defer hook.Close()
+	c := &bot.Configuration{
+		Components: []bot.ComponentConfig{{Name: "database"}},
+		Webhooks:   []bot.WebhookConfig{{URL: hook.URL}},
+		Alertmanager: bot.AlertmanagerConfig{
+			Token: "secret",
+			Rules: []bot.AlertRule{{
+				Match:     map[string]string{"job": "db"},
+				Action:    ActionIncident,
+				Component: "database",
+				Severity:  2,
+			}},
+		},
+	}
+	irc, err := hbot.NewBot("localhost:6667", "blabber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReceiver(irc, db, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(token string, alerts ...*Alert) int {
+		t.Helper()
+		body, err := json.Marshal(Message{Alerts: alerts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/alertmanager", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	expectEvent := func(want string) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("got webhook event %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("no webhook event, want %q", want)
+		}
+	}
+	alerts := func() int {
+		t.Helper()
+		events, err := incident.GetTimeline(db, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, e := range events {
+			if e.Kind == incident.EventAlert {
+				n++
+			}
+		}
+		return n
+	}
+	// Neither alert has a fingerprint.
+	db1 := &Alert{Status: "firing", Labels: map[string]string{"alertname": "Down", "job": "db", "instance": "db1"}}
+	db2 := &Alert{Status: "firing", Labels: map[string]string{"alertname": "Down", "job": "db", "instance": "db2"}}
+
+	if code := send("wrong", db1); code != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a wrong token, want %d", code, http.StatusUnauthorized)
+	}
+	if code := send("secret", db1); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	expectEvent(incident.WebhookStart)
+	if n := alerts(); n != 1 {
+		t.Errorf("got %d alerts in the timeline, want 1", n)
+	}
+	// Alertmanager repeats the firing alerts.
+	if code := send("secret", db1); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if n := alerts(); n != 1 {
+		t.Errorf("got %d alerts in the timeline after a repeat, want 1", n)
+	}
+	// Another alert for the same component goes to the open incident.
+	if code := send("secret", db2); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	expectEvent(incident.WebhookUpdate)
+	if n := alerts(); n != 2 {
+		t.Errorf("got %d alerts in the timeline, want 2", n)
+	}
+	incidents, err := incident.GetOpenIncidents(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 {
+		t.Fatalf("got %d open incidents, want 1", len(incidents))
+	}
+	// Resolving one alert keeps the other one linked to the incident.
+	db1.Status = "resolved"
+	if code := send("secret", db1); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	expectEvent(incident.WebhookUpdate)
+	if n := alerts(); n != 3 {
+		t.Errorf("got %d alerts in the timeline, want 3", n)
+	}
+	for _, test := range []struct {
+		alert  *Alert
+		linked bool
+	}{{db1, false}, {db2, true}} {
+		inc, err := getAlertIncident(db, test.alert.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked := inc != nil; linked != test.linked {
+			t.Errorf("alert %s: got linked %v, want %v", test.alert.Labels["instance"], linked, test.linked)
+		}
+	}
+}
@@ -41,16 +41,25 @@ func NewBot(config *Configuration) (*Bot, error) {
 	if err != nil {
 		return nil, err
 	}
-	db, err := newSQL(config.DbDsn)
+	db, err := OpenDB(config.DbDsn)
+	if err != nil {
+		return nil, err
+	}
 	b := Bot{irc, db}
 	return &b, nil
 }
 
-func newSQL(dsn string) (*sql.DB, error) {
+// OpenDB opens the database described by a DSN like sqlite:///srv/blabber/blabber.db,
+// and upgrades its schema if needed.
+func OpenDB(dsn string) (*sql.DB, error) {
 	parsedDsn := strings.Split(dsn, "://")
 	db, err := sql.Open(parsedDsn[0], parsedDsn[1])
 	if err != nil {
 		return nil, err
 	}
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return db, nil
 }
@@ -7,6 +7,138 @@ import (
 	"sort"
 )
 
+// DocSharing describes who the incident documents get shared with.
+// If no domain, group or user is set, documents are not shared at all.
+type DocSharing struct {
+	// Domain to share the documents with, e.g. "example.org"
+	Domain string `json:"domain"`
+	// Email addresses of the groups to share the documents with
+	Groups []string `json:"groups"`
+	// Email addresses of the users to share the documents with
+	Users []string `json:"users"`
+	// Role granted: "reader", "commenter" or "writer". Defaults to "writer"
+	Role string `json:"role"`
+	// Set to true to make the documents discoverable by the members of the domain
+	Discoverable bool `json:"discoverable"`
+}
+
+// ComponentConfig defines a component that can be affected by incidents.
+type ComponentConfig struct {
+	// The canonical name of the component
+	Name string `json:"name"`
+	// Other names that can be used to refer to the component
+	Aliases []string `json:"aliases"`
+	// The team owning the component
+	Team string `json:"team"`
+	// Set to true if the component is visible to the public
+	Public bool `json:"public"`
+}
+
+// IncidentTemplateConfig defines a type of incident, e.g. "db" or "network".
+type IncidentTemplateConfig struct {
+	// Name of the type, as given to !incident_start --type=<name>
+	Name string `json:"name"`
+	// Template of the incident document, replacing doc_template_id
+	DocTemplate string `json:"doc_template_id"`
+	// Components always affected by this type of incident
+	Components []string `json:"components"`
+	// Steps to follow, posted when the incident is started
+	Checklist []string `json:"checklist"`
+}
+
+// WebhookConfig defines an outgoing webhook, notified of changes to incidents.
+type WebhookConfig struct {
+	// The URL the JSON payload gets POSTed to
+	URL string `json:"url"`
+	// If set, requests are signed with HMAC-SHA256 using this secret
+	Secret string `json:"secret"`
+	// The events to send: "start", "update" and/or "close". All of them if empty.
+	Events []string `json:"events"`
+}
+
+// AlertRule routes Alertmanager alerts matching some labels.
+type AlertRule struct {
+	// Labels the alert must have, with their exact values
+	Match map[string]string `json:"match"`
+	// Labels the alert must have, with values matching the regular expressions
+	MatchRe map[string]string `json:"match_re"`
+	// What to do with matching alerts: "announce" in the channels, or open an "incident"
+	Action string `json:"action"`
+	// The component affected, for the "incident" action
+	Component string `json:"component"`
+	// The severity of the incident, for the "incident" action
+	Severity int64 `json:"severity"`
+	// Set to true to suggest closing the incident when the alert is resolved
+	SuggestClose bool `json:"suggest_close"`
+}
+
+// AlertmanagerConfig configures the ingestion of Alertmanager webhooks.
+type AlertmanagerConfig struct {
+	// Set to true to accept Alertmanager webhooks on the HTTP server
+	Enabled bool `json:"enabled"`
+	// If set, requests must carry an "Authorization: Bearer <token>" header
+	Token string `json:"token"`
+	// Channels where alerts are announced. Defaults to all channels.
+	Channels []string `json:"channels"`
+	// The routing rules. The first one matching an alert is used.
+	Rules []AlertRule `json:"rules"`
+}
+
+// NotifierConfig defines a way of paging people.
+type NotifierConfig struct {
+	// Type of notifier: "smtp" (sends emails) or "http_sms" (sends text messages through an HTTP gateway)
+	Type string `json:"type"`
+	// SMTP server, as host:port
+	SMTPServer string `json:"smtp_server"`
+	// SMTP credentials, if the server requires authentication
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	// Sender of the emails
+	From string `json:"from"`
+	// URL of the SMS gateway, which receives a JSON object with "to" and "message"
+	URL string `json:"url"`
+	// If set, requests to the gateway carry an "Authorization: Bearer <token>" header
+	Token string `json:"token"`
+}
+
+// EscalationConfig defines who gets paged for severe incidents, and when.
+type EscalationConfig struct {
+	// Incidents of this severity or worse page the first tier
+	Severity int64 `json:"severity"`
+	// Minutes without acknowledgement before paging the next tier
+	AckTimeout int64 `json:"ack_timeout"`
+	// Names of the contacts to page, by tier. No tiers disables paging.
+	Tiers [][]string `json:"tiers"`
+	// How to page the contacts. Every contact is paged through all notifiers.
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+// PublisherConfig defines where the approved communications about incidents are published.
+type PublisherConfig struct {
+	// Type of publisher: "http" (status page API), "file" or "webhook"
+	Type string `json:"type"`
+	// URL of the status page API, or of the webhook
+	URL string `json:"url"`
+	// If set, requests to the status page API carry an "Authorization: Bearer <token>" header
+	Token string `json:"token"`
+	// If set, webhook requests are signed with HMAC-SHA256 using this secret
+	Secret string `json:"secret"`
+	// File the messages are appended to
+	Path string `json:"path"`
+}
+
+// TrackerConfig defines the issue tracker the action items of incidents are exported to.
+type TrackerConfig struct {
+	// Type of tracker: "http" (generic JSON API) or "jira". Leave empty to disable the export.
+	Type string `json:"type"`
+	// URL of the API endpoint creating the tasks
+	URL string `json:"url"`
+	// If set, requests carry an "Authorization: Bearer <token>" header
+	Token string `json:"token"`
+	// Project the tasks are created in
+	Project string `json:"project"`
+}
+
 // Configuration holds all the configuration of
 // the bot
 type Configuration struct {
@@ -37,29 +169,124 @@ type Configuration struct {
 	AuthCredentials string `json:"auth_credentials"`
 	// Path where the saved OAuth token is saved or will be saved.
 	AuthToken string `json:"auth_token"`
-	// Base template document for incidents
+	// JSON key of a service account to use instead of OAuth tokens
+	AuthServiceAccount string `json:"auth_service_account"`
+	// User the service account should impersonate, with domain-wide delegation
+	AuthSubject string `json:"auth_subject"`
+	// Backend used for incident documents: "gdocs", "markdown" or "none"
+	DocBackend string `json:"doc_backend"`
+	// Base template document for incidents. For the markdown backend,
+	// the path to a text/template file.
 	DocTemplate string `json:"doc_template_id"`
 	// Id of the drive where to create the doc
 	DocDrive string `json:"doc_drive"`
 	// Folder where to create the doc
 	DocFolder string `json:"doc_folder"`
+	// Who to share the doc with
+	DocSharing DocSharing `json:"doc_sharing"`
+	// Directory where the markdown backend writes the documents
+	DocDirectory string `json:"doc_directory"`
+	// Base url the markdown documents are served at. If empty, file:// urls are used.
+	DocBaseURL string `json:"doc_base_url"`
+	// The catalog of components that can be affected by incidents.
+	// More components can be added at runtime with !component_add
+	Components []ComponentConfig `json:"components"`
+	// Types of incidents, with their own document template, components and checklist
+	IncidentTemplates []IncidentTemplateConfig `json:"incident_templates"`
+	// Address the embedded HTTP server listens on, e.g. "127.0.0.1:8080".
+	// If empty, the HTTP server is not started.
+	HTTPListen string `json:"http_listen"`
+	// Set to true to serve the public status page
+	StatusPage bool `json:"status_page"`
+	// Title of the status page
+	StatusPageTitle string `json:"status_page_title"`
+	// Set to true to serve an Atom feed of the recent incidents
+	AtomFeed bool `json:"atom_feed"`
+	// Public base URL of the HTTP server, used for links in the feed
+	HTTPBaseURL string `json:"http_base_url"`
+	// Outgoing webhooks notified of incident changes
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// Ingestion of Alertmanager webhooks
+	Alertmanager AlertmanagerConfig `json:"alertmanager"`
+	// Set to true to show the incident commander in the topic of non-public channels
+	TopicRoles bool `json:"topic_roles"`
+	// Go text/template file used to render postmortem reports
+	ReportTemplate string `json:"report_template"`
+	// Directory where postmortem reports are written, if set
+	ReportDirectory string `json:"report_directory"`
+	// Set to true to write the postmortem report when an incident is closed
+	ReportOnClose bool `json:"report_on_close"`
+	// Directory where !incident_export writes the exported incidents
+	ExportDirectory string `json:"export_directory"`
+	// Datacenters or regions that incidents can affect. If empty, any region is accepted.
+	Regions []string `json:"regions"`
+	// Issue tracker the action items are exported to, if any
+	IssueTracker TrackerConfig `json:"issue_tracker"`
+	// Minutes before the start of a maintenance window when a reminder is sent, 0 to disable reminders
+	MaintenanceReminder int64 `json:"maintenance_reminder"`
+	// Set to true to serve an iCalendar export of the maintenance windows
+	MaintenanceCalendar bool `json:"maintenance_calendar"`
+	// Minutes without updates after which an open incident is considered stale, by severity.
+	// Severities without a value, or with 0, get no reminders.
+	StaleAfter map[int64]int64 `json:"stale_after"`
+	// Time of the day (UTC, e.g. "09:00") when the digest of open incidents is posted.
+	// If empty, no digest is posted.
+	DigestTime string `json:"digest_time"`
+	// Incidents of this severity or worse get a dedicated channel. 0 disables dedicated channels
+	IncidentChannelSeverity int64 `json:"incident_channel_severity"`
+	// Prefix of the dedicated channels, followed by the incident id
+	IncidentChannelPrefix string `json:"incident_channel_prefix"`
+	// Minutes after the incident is closed before leaving its dedicated channel
+	IncidentChannelPartAfter int64 `json:"incident_channel_part_after"`
+	// Nicks of the on-call people, invited to the dedicated channels
+	OnCall []string `json:"on_call"`
+	// Messages starting with one of these markers are added to the timeline of the open incident
+	LogMarkers []string `json:"log_markers"`
+	// Paging of people for severe incidents
+	Escalation EscalationConfig `json:"escalation"`
+	// Name of the ACL whose members can approve communications. Use !acl_add <name> <identifier> to add members.
+	CommsApprovers string `json:"comms_approvers"`
+	// Where approved communications are published
+	CommsPublishers []PublisherConfig `json:"comms_publishers"`
+}
+
+// DefaultComponents is the component catalog used when the configuration doesn't define one.
+// These are the components blabber used to accept before the catalog existed.
+var DefaultComponents = []ComponentConfig{
+	{Name: "Website", Public: true},
+	{Name: "Mobile apps", Public: true},
+	{Name: "Action API", Public: true},
+	{Name: "REST api", Public: true},
+	{Name: "Multimedia", Public: true},
+	{Name: "Thumbnails", Public: true},
+	{Name: "Other", Public: true},
 }
 
 // GetConfig initializes a configuration object
 // from reading a properly formatted json file
 func GetConfig(fileName string) (*Configuration, error) {
 	config := Configuration{
-		ServerName:      "irc.freenode.net",
-		ServerPort:      6697,
-		UseTLS:          true,
-		UseSASL:         true,
-		NickName:        "BlabberBot",
-		Channels:        []string{"#somechannel"},
-		DbDsn:           "sqlite3://file:blabber.db?cache=shared",
-		AuthCredentials: "credentials.json",
-		AuthToken:       "token.json",
+		ServerName:               "irc.freenode.net",
+		ServerPort:               6697,
+		UseTLS:                   true,
+		UseSASL:                  true,
+		NickName:                 "BlabberBot",
+		Channels:                 []string{"#somechannel"},
+		DbDsn:                    "sqlite3://file:blabber.db?cache=shared",
+		AuthCredentials:          "credentials.json",
+		AuthToken:                "token.json",
+		DocBackend:               "gdocs",
+		DocDirectory:             "docs",
+		StatusPageTitle:          "Service status",
+		MaintenanceReminder:      30,
+		IncidentChannelPrefix:    "#incident-",
+		IncidentChannelPartAfter: 60,
+		LogMarkers:               []string{"!log", "#info"},
+		Escalation:               EscalationConfig{Severity: 2, AckTimeout: 15},
+		CommsApprovers:           "comms_approvers",
 	}
 	if fileName == "" {
+		config.defaultComponents()
 		return &config, nil
 	}
 	file, err := os.Open(fileName)
@@ -72,9 +299,20 @@ func GetConfig(fileName string) (*Configuration, error) {
 	if err != nil {
 		return nil, err
 	}
+	config.defaultComponents()
 	return &config, err
 }
 
+// defaultComponents uses DefaultComponents if the components are not configured. An empty list
+// is kept, to only use the components added at runtime. It must be called after decoding the
+// configuration: decoding into the default components would merge them with the configured
+// ones, e.g. making internal components public.
+func (c *Configuration) defaultComponents() {
+	if c.Components == nil {
+		c.Components = append([]ComponentConfig{}, DefaultComponents...)
+	}
+}
+
 // GetServerString gives you a host:port string of the server to connect to.
 func (c *Configuration) GetServerString() string {
 	return fmt.Sprintf("%s:%d", c.ServerName, c.ServerPort)
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetConfigComponents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blabber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name   string
+		config string
+		want   []ComponentConfig
+	}{
+		{"no components", `{"nick": "bot"}`, DefaultComponents},
+		{"empty list", `{"components": []}`, []ComponentConfig{}},
+		{"public is false by default", `{"components": [{"name": "Internal", "team": "a"}, {"name": "Website", "public": true}]}`,
+			[]ComponentConfig{{Name: "Internal", Team: "a"}, {Name: "Website", Public: true}}},
+		{"nothing is inherited from the defaults", `{"components": [{"name": "Search"}]}`, []ComponentConfig{{Name: "Search"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.json")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			c, err := GetConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Components, tt.want) {
+				t.Errorf("got components %+v, want %+v", c.Components, tt.want)
+			}
+			// Changing the configuration must not change the defaults used by the next one.
+			if len(c.Components) > 0 {
+				c.Components[0].Name = "changed"
+			}
+		})
+	}
+	c, err := GetConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Components, DefaultComponents) {
+		t.Errorf("got components %+v without a configuration file, want %+v", c.Components, DefaultComponents)
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// tables are the tables added to schema.sql over time. They're created at startup
+// if the database is older than them.
+var tables = []string{
+	"CREATE TABLE IF NOT EXISTS incident_events (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER, `kind` VARCHAR(64), `author` VARCHAR(256), `created_at` DATETIME, `text` TEXT)",
+	"CREATE TABLE IF NOT EXISTS incident_roles (`incident_id` INTEGER, `role` VARCHAR(64), `nick` VARCHAR(256), `assigned_by` VARCHAR(256), `assigned_at` DATETIME)",
+	"CREATE TABLE IF NOT EXISTS document_updates (`id` INTEGER PRIMARY KEY, `document_id` VARCHAR(256), `text` TEXT, `attempts` INTEGER, `created_at` DATETIME)",
+	"CREATE TABLE IF NOT EXISTS incident_reports (`incident_id` INTEGER PRIMARY KEY, `document_id` VARCHAR(256), `path` VARCHAR(1024), `created_at` DATETIME)",
+	"CREATE TABLE IF NOT EXISTS components (`name` VARCHAR(256) PRIMARY KEY, `aliases` VARCHAR(1024), `team` VARCHAR(256), `public` INTEGER)",
+	"CREATE TABLE IF NOT EXISTS alert_incidents (`fingerprint` VARCHAR(256) PRIMARY KEY, `incident_id` INTEGER)",
+	"CREATE TABLE IF NOT EXISTS maintenances (`id` INTEGER PRIMARY KEY, `starts_at` DATETIME, `ends_at` DATETIME, `components` VARCHAR(256), `description` TEXT, `author` VARCHAR(256), `state` INTEGER)",
+	"CREATE TABLE IF NOT EXISTS incident_links (`incident_id` INTEGER, `linked_id` INTEGER, `kind` VARCHAR(64), `created_by` VARCHAR(256), `created_at` DATETIME)",
+	"CREATE TABLE IF NOT EXISTS incident_pages (`incident_id` INTEGER PRIMARY KEY, `tier` INTEGER, `paged_at` DATETIME, `acked_by` VARCHAR(256), `acked_at` DATETIME)",
+	"CREATE TABLE IF NOT EXISTS incident_comms (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER, `text` TEXT, `author` VARCHAR(256), `created_at` DATETIME, `approved_by` VARCHAR(256), `approved_at` DATETIME, `published_at` DATETIME, `published_to` TEXT)",
+	"CREATE TABLE IF NOT EXISTS incident_actions (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER REFERENCES incidents(`id`), `number` INTEGER, `owner` VARCHAR(256), `text` TEXT, `created_by` VARCHAR(256), `created_at` DATETIME, `done_by` VARCHAR(256), `done_at` DATETIME, `task` VARCHAR(1024))",
+	"CREATE TABLE IF NOT EXISTS imported_incidents (`source_id` INTEGER, `started_at` DATETIME, `incident_id` INTEGER, PRIMARY KEY (`source_id`, `started_at`))",
+}
+
+// searchTable is the full text search index. Not all SQLite builds support FTS,
+// and blabber can do without it, so failing to create it is not an error.
+const searchTable = "CREATE VIRTUAL TABLE IF NOT EXISTS incident_search USING fts4(`components`, `description`, `timeline`)"
+
+// column is a column added to an existing table.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// columns are the columns added to existing tables over time, in the order they were added.
+var columns = []column{
+	{"incidents", "channel", "VARCHAR(256)"},
+	{"incident_comms", "published_to", "TEXT"},
+	{"incidents", "impact", "TEXT"},
+}
+
+// Migrate brings a database created with an older schema.sql up to date. It can safely run
+// on every start, as it only creates the tables and columns that don't exist yet.
+func Migrate(db *sql.DB) error {
+	for _, query := range tables {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("Could not migrate the database: %v", err)
+		}
+	}
+	if _, err := db.Exec(searchTable); err != nil {
+		log.Error("Could not create the search index, falling back to a slower search", "error", err)
+	}
+	for _, col := range columns {
+		exists, err := hasColumn(db, col.table, col.name)
+		if err != nil {
+			return fmt.Errorf("Could not migrate the database: %v", err)
+		}
+		if exists {
+			continue
+		}
+		log.Info("Adding a column to the database", "table", col.table, "column", col.name)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN `%s` %s", col.table, col.name, col.definition)); err != nil {
+			return fmt.Errorf("Could not migrate the database: %v", err)
+		}
+	}
+	return nil
+}
+
+// hasColumn tells you if a table has a column.
+func hasColumn(db *sql.DB, table string, name string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var colName, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if colName == name {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
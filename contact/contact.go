@@ -16,6 +16,21 @@ type Contact struct {
 	email string
 }
 
+// Name returns the name of the contact.
+func (self *Contact) Name() string {
+	return self.name
+}
+
+// Phone returns the phone number of the contact.
+func (self *Contact) Phone() string {
+	return self.phone
+}
+
+// Email returns the email address of the contact.
+func (self *Contact) Email() string {
+	return self.email
+}
+
 // Get a contact from the db
 func GetContact(db *sql.DB, name string) (*Contact, error) {
 	var c Contact
@@ -1,5 +1,7 @@
 module blabber
 
+go 1.16
+
 require (
 	cloud.google.com/go v0.37.4 // indirect
 	github.com/inconshreveable/log15 v0.0.0-20180818164646-67afb5ed74ec // indirect
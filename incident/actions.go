@@ -0,0 +1,260 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/tracker"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Action is a follow-up task of an incident, e.g. fixing its root cause.
+type Action struct {
+	ID         int64
+	IncidentID int64
+	// Number of the action among the ones of the incident, starting from 1
+	Number    int64
+	Owner     string
+	Text      string
+	Author    string
+	CreatedAt time.Time
+	DoneBy    string
+	DoneAt    time.Time
+	// Reference to the task in the issue tracker, if it was exported
+	Task string
+}
+
+// IsDone tells you if the action was completed.
+func (a *Action) IsDone() bool {
+	return a.DoneBy != ""
+}
+
+// String formats the action as a single line, suitable for IRC.
+func (a *Action) String() string {
+	line := fmt.Sprintf("#%d.%d [%s] %s", a.IncidentID, a.Number, a.Owner, a.Text)
+	if a.Task != "" {
+		line += fmt.Sprintf(" (task: %s)", a.Task)
+	}
+	if a.IsDone() {
+		line += fmt.Sprintf(" - done by %s on %s", a.DoneBy, a.DoneAt.Format("2006-01-02"))
+	}
+	return line
+}
+
+// Save persists the action to the database.
+func (a *Action) Save(db *sql.DB) error {
+	var query string
+	if a.ID == 0 {
+		query = "INSERT INTO incident_actions (incident_id, number, owner, text, created_by, created_at, done_by, done_at, task) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	} else {
+		query = "UPDATE incident_actions SET incident_id=?, number=?, owner=?, text=?, created_by=?, created_at=?, done_by=?, done_at=?, task=? WHERE id = ?"
+	}
+	statement, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{a.IncidentID, a.Number, a.Owner, a.Text, a.Author, a.CreatedAt.Format(time.RFC3339),
+		a.DoneBy, formatOptionalTime(a.DoneAt), a.Task}
+	if a.ID != 0 {
+		_, err = statement.Exec(append(args, a.ID)...)
+		return err
+	}
+	result, err := statement.Exec(args...)
+	if err != nil {
+		return err
+	}
+	a.ID, err = result.LastInsertId()
+	return err
+}
+
+func getActions(db *sql.DB, query string, args ...interface{}) ([]*Action, error) {
+	statement, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var actions []*Action
+	for rows.Next() {
+		a := Action{}
+		var created, done string
+		if err := rows.Scan(&a.ID, &a.IncidentID, &a.Number, &a.Owner, &a.Text, &a.Author, &created, &a.DoneBy, &done, &a.Task); err != nil {
+			return nil, err
+		}
+		if a.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, err
+		}
+		if a.DoneAt, err = parseOptionalTime(done); err != nil {
+			return nil, err
+		}
+		actions = append(actions, &a)
+	}
+	return actions, rows.Err()
+}
+
+// Actions returns the action items of the incident, in the order they were added.
+func (i *Incident) Actions(db *sql.DB) ([]*Action, error) {
+	return getActions(db, "SELECT id, incident_id, number, owner, text, created_by, created_at, done_by, done_at, task FROM incident_actions WHERE incident_id = ? ORDER BY number", i.ID)
+}
+
+// GetOpenActions returns the action items not done yet, across all incidents.
+// If an owner is given, only their actions are returned.
+func GetOpenActions(db *sql.DB, owner string) ([]*Action, error) {
+	query := "SELECT id, incident_id, number, owner, text, created_by, created_at, done_by, done_at, task FROM incident_actions WHERE done_by = ''"
+	if owner == "" {
+		return getActions(db, query+" ORDER BY incident_id, number")
+	}
+	return getActions(db, query+" AND owner = ? ORDER BY incident_id, number", owner)
+}
+
+// AddAction adds an action item to the incident, and records it in the timeline.
+// The incident still needs to be saved.
+func (i *Incident) AddAction(db *sql.DB, owner string, text string, author string) (*Action, error) {
+	var last int64
+	if err := db.QueryRow("SELECT IFNULL(MAX(number), 0) FROM incident_actions WHERE incident_id = ?", i.ID).Scan(&last); err != nil {
+		return nil, err
+	}
+	a := Action{IncidentID: i.ID, Number: last + 1, Owner: owner, Text: text, Author: author, CreatedAt: time.Now()}
+	if err := a.Save(db); err != nil {
+		return nil, err
+	}
+	i.updatedAt = time.Now()
+	i.AddEvent(EventAction, author, fmt.Sprintf("added action %d for %s: %s", a.Number, owner, text))
+	return &a, nil
+}
+
+// CompleteAction marks an action item of the incident as done, and records it in the timeline.
+// The incident still needs to be saved.
+func (i *Incident) CompleteAction(db *sql.DB, number int64, author string) (*Action, error) {
+	actions, err := i.Actions(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range actions {
+		if a.Number != number {
+			continue
+		}
+		if a.IsDone() {
+			return nil, fmt.Errorf("Action %d of incident %d was already done by %s", number, i.ID, a.DoneBy)
+		}
+		a.DoneBy = author
+		a.DoneAt = time.Now()
+		if err := a.Save(db); err != nil {
+			return nil, err
+		}
+		i.updatedAt = time.Now()
+		i.AddEvent(EventAction, author, fmt.Sprintf("done action %d: %s", a.Number, a.Text))
+		return a, nil
+	}
+	return nil, fmt.Errorf("Incident %d has no action %d", i.ID, number)
+}
+
+// exportAction creates a task for the action in the issue tracker, if one is configured.
+func exportAction(db *sql.DB, c *bot.Configuration, inc *Incident, a *Action) error {
+	if c.IssueTracker.Type == "" {
+		return nil
+	}
+	t, err := tracker.New(c.IssueTracker)
+	if err != nil {
+		return err
+	}
+	task := tracker.Task{
+		IncidentID:  inc.ID,
+		Title:       fmt.Sprintf("Incident #%d follow-up: %s", inc.ID, a.Text),
+		Description: fmt.Sprintf("Follow-up of incident #%d, affecting %s.\n\n%s", inc.ID, strings.Join(inc.components, ", "), a.Text),
+		Owner:       a.Owner,
+	}
+	if inc.Document != nil {
+		task.Description += "\n\nIncident document: " + inc.Document.Url()
+	}
+	if a.Task, err = t.CreateTask(&task); err != nil {
+		return err
+	}
+	return a.Save(db)
+}
+
+// IRC actions
+func incidentAction(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	var a *Action
+	var err error
+	if args[1] == "add" {
+		fields := strings.SplitN(args[2], " ", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			irc.Reply(m, fmt.Sprintf("Please give an owner and a description: !incident_action %d add <owner> <text>", inc.ID))
+			return true
+		}
+		a, err = inc.AddAction(db, fields[0], strings.TrimSpace(fields[1]), m.Name)
+	} else {
+		number, parseErr := strconv.ParseInt(args[2], 10, 64)
+		if parseErr != nil {
+			irc.Reply(m, fmt.Sprintf("Please give the number of the action: !incident_action %d done <n>", inc.ID))
+			return true
+		}
+		a, err = inc.CompleteAction(db, number, m.Name)
+	}
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if !saveAction(inc, db, irc, m, c) {
+		return true
+	}
+	if args[1] == "add" {
+		if err := exportAction(db, c, inc, a); err != nil {
+			irc.Reply(m, "The action was added, but could not be exported to the issue tracker. Please check the logs")
+			log.Error("Could not export the action", "error", err, "incident", inc.ID)
+		}
+	}
+	irc.Reply(m, a.String())
+	return true
+}
+
+// saveAction saves the changes to the action items of an incident. Those of closed incidents
+// are only recorded in the timeline and the document: they're not a change of the incident
+// worth notifying the webhooks or updating the topics.
+func saveAction(inc *Incident, db *sql.DB, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration) bool {
+	if inc.Status != StatusClosed {
+		return saveIncident(inc, db, irc, m, c)
+	}
+	if err := inc.Save(db); err != nil {
+		irc.Reply(m, "Could not save the incident, please check the logs for errors")
+		log.Error("Could not update incident", "error", err, "incident", inc.ID)
+		return false
+	}
+	go func() {
+		if err := FlushDocumentUpdates(db); err != nil {
+			log.Error("Could not flush the document updates", "error", err)
+		}
+	}()
+	return true
+}
+
+func listActions(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	actions, err := GetOpenActions(db, args[0])
+	if err != nil {
+		irc.Reply(m, "Could not retrieve the action items. Please check the logs")
+		log.Error("Could not retrieve the open action items", "error", err)
+		return true
+	}
+	if len(actions) == 0 {
+		irc.Reply(m, "No open action items! 👍")
+		return true
+	}
+	irc.Reply(m, "Open action items:")
+	for _, a := range actions {
+		irc.Reply(m, "  * "+a.String())
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestActionsCommand(t *testing.T) {
+	testCommand(t, "actions", []commandTest{
+		{"!actions", []string{""}},
+		{"!actions  ", []string{""}},
+		{"!actions alice", []string{"alice"}},
+		{"BlabberBot: !actions alice ", []string{"alice"}},
+		{"!actionsalice", nil},
+		{"!actions alice bob", nil},
+	})
+	testCommand(t, "incident_action", []commandTest{
+		{"!incident_action 12 add alice fix the failover script", []string{"12", "add", "alice fix the failover script"}},
+		{"!incident_action 12 done 3 ", []string{"12", "done", "3"}},
+		{"!incident_action 12 remove 3", nil},
+		{"!incident_action 12", nil},
+	})
+}
+
+func TestActions(t *testing.T) {
+	db := newTestDB(t)
+	inc := &Incident{severity: 3, components: []string{"Website"}, Status: StatusClosed, startedAt: time.Now(), updatedAt: time.Now()}
+	if err := inc.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []string{"alice", "bob", "alice"} {
+		if _, err := inc.AddAction(db, owner, "follow up", "carol"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := inc.CompleteAction(db, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inc.CompleteAction(db, 1, "alice"); err == nil {
+		t.Error("completing an action twice should fail")
+	}
+	if _, err := inc.CompleteAction(db, 4, "alice"); err == nil {
+		t.Error("completing an action that doesn't exist should fail")
+	}
+	if len(inc.pendingEvents) != 4 {
+		t.Errorf("got %d events in the timeline, want 4", len(inc.pendingEvents))
+	}
+	tests := []struct {
+		owner   string
+		numbers []int64
+	}{
+		{"", []int64{2, 3}},
+		{"alice", []int64{3}},
+		{"bob", []int64{2}},
+		{"dave", nil},
+	}
+	for _, tt := range tests {
+		actions, err := GetOpenActions(db, tt.owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var numbers []int64
+		for _, a := range actions {
+			numbers = append(numbers, a.Number)
+		}
+		if !reflect.DeepEqual(numbers, tt.numbers) {
+			t.Errorf("owner %q: got actions %v, want %v", tt.owner, numbers, tt.numbers)
+		}
+	}
+}
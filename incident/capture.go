@@ -0,0 +1,161 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// logTargetRegex matches the id of the incident at the start of a log message, e.g. "#42 restarted the db".
+var logTargetRegex = regexp.MustCompile(`^#(\d+)\s+(.+)$`)
+
+// getOpenIncidentsForCapture returns the open incidents, without fetching their
+// documents: this is called for every message, and must be fast.
+func getOpenIncidentsForCapture(db *sql.DB) ([]*Incident, map[int64]string, error) {
+	statement, err := db.Prepare("SELECT id, components, description, IFNULL(document_id, ''), IFNULL(channel, '') FROM incidents WHERE status != ?")
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := statement.Query(StatusClosed)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var incidents []*Incident
+	documents := make(map[int64]string)
+	for rows.Next() {
+		inc := Incident{}
+		var components, documentID string
+		if err := rows.Scan(&inc.ID, &components, &inc.Description, &documentID, &inc.Channel); err != nil {
+			return nil, nil, err
+		}
+		inc.components = strings.Split(components, ", ")
+		documents[inc.ID] = documentID
+		incidents = append(incidents, &inc)
+	}
+	return incidents, documents, rows.Err()
+}
+
+// logMarker returns the text following a log marker at the start of the message, if any.
+func logMarker(c *bot.Configuration, content string) (string, bool) {
+	for _, marker := range c.LogMarkers {
+		if content == marker {
+			return "", true
+		}
+		if strings.HasPrefix(content, marker+" ") {
+			return strings.TrimSpace(strings.TrimPrefix(content, marker)), true
+		}
+	}
+	return "", false
+}
+
+// captureEvent adds a message to the timeline of the incident, and queues it for the incident document.
+// The incident is marked as updated in the same transaction, so that no reminders are sent about it.
+func captureEvent(db *sql.DB, inc *Incident, documentID string, author string, at time.Time, text string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	e := Event{IncidentID: inc.ID, Kind: EventLog, Author: author, CreatedAt: at, Text: text}
+	if err := e.Save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("UPDATE incidents SET updated_at = ? WHERE id = ?", at.Format(time.RFC3339), inc.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if documentID != "" {
+		u := DocumentUpdate{DocumentID: documentID, Text: e.String(), CreatedAt: time.Now()}
+		if err := u.Save(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// The search index is not critical, don't fail the capture for it.
+	if err := indexIncident(tx, inc); err != nil {
+		log.Error("Could not index the incident for search", "error", err, "incident", inc.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	inc.updatedAt = at
+	if documentID != "" {
+		go func() {
+			if err := FlushDocumentUpdates(db); err != nil {
+				log.Error("Could not flush the document updates", "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// CaptureLog records channel messages in the timeline of the open incidents: messages starting
+// with a log marker (e.g. "!log" or "#info") followed by the id of the incident in any channel,
+// e.g. "!log #42 the database was restarted", and all messages in the dedicated channel of
+// an incident. Markers have other uses outside incidents, e.g. "!log" for server admin logs,
+// so markers without an id are only captured in the dedicated channel of an incident.
+func CaptureLog(irc *hbot.Bot, m *hbot.Message, db *sql.DB, c *bot.Configuration) bool {
+	if m.Command != "PRIVMSG" || !strings.HasPrefix(m.To, "#") {
+		return false
+	}
+	text, marked := logMarker(c, m.Content)
+	// Other commands are never logged.
+	if !marked && strings.HasPrefix(m.Content, "!") {
+		return false
+	}
+	LockIncidents()
+	defer UnlockIncidents()
+	incidents, documents, err := getOpenIncidentsForCapture(db)
+	if err != nil {
+		log.Error("Could not fetch the open incidents", "error", err)
+		return false
+	}
+	if len(incidents) == 0 {
+		return false
+	}
+	var target *Incident
+	for _, inc := range incidents {
+		if inc.Channel != "" && strings.EqualFold(inc.Channel, m.To) {
+			target = inc
+		}
+	}
+	if !marked && target == nil {
+		return false
+	}
+	if marked {
+		if matches := logTargetRegex.FindStringSubmatch(text); matches != nil {
+			id, _ := strconv.ParseInt(matches[1], 10, 64)
+			target = nil
+			for _, inc := range incidents {
+				if inc.ID == id {
+					target = inc
+				}
+			}
+			if target == nil {
+				irc.Reply(m, fmt.Sprintf("Incident %d is not open.", id))
+				return true
+			}
+			text = matches[2]
+		} else if target == nil {
+			return false
+		}
+		if text == "" {
+			return true
+		}
+	} else {
+		text = m.Content
+	}
+	if err := captureEvent(db, target, documents[target.ID], m.Name, m.TimeStamp, text); err != nil {
+		irc.Reply(m, "Could not add the message to the incident timeline, please check the logs.")
+		log.Error("Could not capture the message", "error", err, "incident", target.ID)
+	}
+	return marked
+}
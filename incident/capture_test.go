@@ -0,0 +1,85 @@
+package incident
+
+import (
+	"blabber/bot"
+	"testing"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func TestCaptureLog(t *testing.T) {
+	db := newTestDB(t)
+	c := &bot.Configuration{LogMarkers: []string{"!log", "#info"}}
+	// The replies are not tested: irc is nil, so a reply fails the test.
+	var irc *hbot.Bot
+	message := func(channel string, content string) *hbot.Message {
+		m := hbot.ParseMessage(":alice!alice@example.org PRIVMSG " + channel + " :" + content)
+		m.TimeStamp = time.Now()
+		return m
+	}
+	// Nothing is open: markers are ignored silently.
+	if CaptureLog(irc, message("#ops", "!log restarted the app servers"), db, c) {
+		t.Error("a log message was captured without open incidents")
+	}
+	for _, inc := range []*Incident{
+		{severity: 3, components: []string{"Website"}, Status: StatusOpen},
+		{severity: 1, components: []string{"Search"}, Status: StatusIdentified, Channel: "#incident-2"},
+		{severity: 2, components: []string{"Thumbnails"}, Status: StatusClosed},
+	} {
+		inc.startedAt, inc.updatedAt = time.Now(), time.Now()
+		if err := inc.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		channel  string
+		content  string
+		handled  bool
+		incident int64
+		text     string
+	}{
+		{"marker without id", "#ops", "!log restarted the app servers", false, 0, ""},
+		{"marker with id", "#ops", "!log #1 restarted the app servers", true, 1, "restarted the app servers"},
+		{"other marker with id", "#ops", "#info #2 the cluster is red", true, 2, "the cluster is red"},
+		{"marker glued to the text", "#ops", "!logrotate #1 done", false, 0, ""},
+		{"private message", "alice", "!log #1 restarted", false, 0, ""},
+		{"dedicated channel, marker without id", "#incident-2", "!log reindexing", true, 2, "reindexing"},
+		{"dedicated channel, marker for another incident", "#incident-2", "!log #1 purged the caches", true, 1, "purged the caches"},
+		{"dedicated channel, message", "#incident-2", "the reindex is at 50%", false, 2, "the reindex is at 50%"},
+		{"dedicated channel, command", "#incident-2", "!incident_list", false, 0, ""},
+		{"other channel, message", "#ops", "the reindex is at 50%", false, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := make(map[int64]int)
+			for id := int64(1); id <= 3; id++ {
+				timeline, err := GetTimeline(db, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				counts[id] = len(timeline)
+			}
+			if handled := CaptureLog(irc, message(tt.channel, tt.content), db, c); handled != tt.handled {
+				t.Errorf("got handled %t, want %t", handled, tt.handled)
+			}
+			for id := int64(1); id <= 3; id++ {
+				timeline, err := GetTimeline(db, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				added := timeline[counts[id]:]
+				if id != tt.incident {
+					if len(added) != 0 {
+						t.Errorf("incident %d: unexpected events %+v", id, added[0])
+					}
+					continue
+				}
+				if len(added) != 1 || added[0].Kind != EventLog || added[0].Author != "alice" || added[0].Text != tt.text {
+					t.Errorf("incident %d: got events %+v, want a log of %q", id, added, tt.text)
+				}
+			}
+		})
+	}
+}
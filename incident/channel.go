@@ -0,0 +1,105 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// partTimers are the pending departures from the channels of closed incidents, by incident id.
+var partTimers = struct {
+	sync.Mutex
+	timers map[int64]*time.Timer
+}{timers: make(map[int64]*time.Timer)}
+
+// needsChannel tells you if the incident is severe enough to get a dedicated channel.
+func (i *Incident) needsChannel(c *bot.Configuration) bool {
+	return c.IncidentChannelSeverity > 0 && SeverityAtLeast(i.severity, c.IncidentChannelSeverity)
+}
+
+// channelTopic returns the topic of the dedicated channel. Only the people
+// working on the incident are there, so the document link is included.
+func (i *Incident) channelTopic() string {
+	if i.Status == StatusClosed {
+		return fmt.Sprintf("Incident #%d is resolved", i.ID)
+	}
+	return fmt.Sprintf("Incident #%d: %s", i.ID, i.Summary(true))
+}
+
+// OpenChannel creates the dedicated channel of a severe incident, if it doesn't have one yet,
+// and invites the given people and the on-call people to it.
+func (i *Incident) OpenChannel(irc *hbot.Bot, db *sql.DB, c *bot.Configuration, invite []string) error {
+	if i.Channel != "" || i.Status == StatusClosed || !i.needsChannel(c) {
+		return nil
+	}
+	i.Channel = fmt.Sprintf("%s%d", c.IncidentChannelPrefix, i.ID)
+	statement, err := db.Prepare("UPDATE incidents SET channel = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	if _, err := statement.Exec(i.Channel, i.ID); err != nil {
+		return err
+	}
+	irc.Join(i.Channel)
+	irc.Topic(i.Channel, i.channelTopic())
+	invited := make(map[string]bool)
+	for _, nick := range append(invite, c.OnCall...) {
+		if nick != "" && !invited[nick] {
+			irc.Send(fmt.Sprintf("INVITE %s %s", nick, i.Channel))
+			invited[nick] = true
+		}
+	}
+	announce(irc, c, fmt.Sprintf("Incident #%d is handled in %s", i.ID, i.Channel))
+	return nil
+}
+
+// updateChannel updates the topic of the dedicated channel, if any. Once the incident
+// is closed, the bot leaves the channel after the configured time.
+func (i *Incident) updateChannel(irc *hbot.Bot, c *bot.Configuration) {
+	if i.Channel == "" {
+		return
+	}
+	partTimers.Lock()
+	defer partTimers.Unlock()
+	if timer, ok := partTimers.timers[i.ID]; ok {
+		timer.Stop()
+		delete(partTimers.timers, i.ID)
+	}
+	if i.Status != StatusClosed {
+		// Rejoin the channel, in case the incident was reopened after we left.
+		irc.Join(i.Channel)
+		irc.Topic(i.Channel, i.channelTopic())
+		return
+	}
+	irc.Topic(i.Channel, i.channelTopic())
+	id, channel := i.ID, i.Channel
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(c.IncidentChannelPartAfter)*time.Minute, func() {
+		irc.Send(fmt.Sprintf("PART %s :Incident #%d is resolved", channel, id))
+		partTimers.Lock()
+		if partTimers.timers[id] == timer {
+			delete(partTimers.timers, id)
+		}
+		partTimers.Unlock()
+	})
+	partTimers.timers[id] = timer
+}
+
+// GetOpenChannels returns the dedicated channels of the open incidents, to join them when the bot starts.
+func GetOpenChannels(db *sql.DB) ([]string, error) {
+	incidents, err := getOpenIncidents(db, false)
+	if err != nil {
+		return nil, err
+	}
+	var channels []string
+	for _, inc := range incidents {
+		if inc.Channel != "" {
+			channels = append(channels, inc.Channel)
+		}
+	}
+	return channels, nil
+}
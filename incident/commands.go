@@ -6,20 +6,92 @@ import "blabber/triggers"
 var IrcCommands = []*triggers.Command{
 	triggers.NewCommand(
 		"incident_start",
-		"(?P<severity>\\d+)\\s+(?P<components_comma_sep>.+)$",
-		"Start an incident",
+		"(?:--type=(?P<type>\\S+)\\s+)?(?P<severity>\\d+)(?:\\s+(?P<components_comma_sep>.+))?$",
+		"Start an incident, optionally of one of the configured types",
 		true,
 		false,
 		startIncident,
 	),
 	triggers.NewCommand(
 		"incident_update",
-		`(?P<id>\d+)\s+(?P<what>severity|description)\s+(?P<value>.+)$`,
-		"Update an incident. You can update either severity or the incident description",
+		`(?P<id>\d+)\s+(?P<what>severity|description|impact)\s+(?P<value>.+)$`,
+		"Update an incident. You can update the severity, the incident description or its impact",
 		true,
 		false,
 		updateIncident,
 	),
+	triggers.NewCommand(
+		"incident_status",
+		`(?P<id>\d+)\s+(?P<state>investigating|identified|monitoring|resolved)\s*$`,
+		"Moves an incident to a new phase: investigating, identified, monitoring or resolved",
+		true,
+		false,
+		setIncidentStatus,
+	),
+	triggers.NewCommand(
+		"incident_role",
+		`(?P<id>\d+)\s+(?P<role>commander|comms|scribe)\s+(?P<nick>\S+)\s*$`,
+		"Assigns a role (commander, comms or scribe) on an incident",
+		true,
+		false,
+		assignRole,
+	),
+	triggers.NewCommand(
+		"incident_merge",
+		`(?P<src>\d+)\s+(?P<dst>\d+)\s*$`,
+		"Merges a duplicate incident into another one, copying its notes and closing it",
+		true,
+		false,
+		mergeIncidents,
+	),
+	triggers.NewCommand(
+		"incident_link",
+		`(?P<id>\d+)\s+(?P<other_id>\d+)\s*$`,
+		"Records that two incidents are related",
+		true,
+		false,
+		linkIncidents,
+	),
+	triggers.NewCommand(
+		"ack",
+		"(?P<id>\\d+)\\s*$",
+		"Acknowledges the page for an incident, stopping the escalation",
+		true,
+		true,
+		ackPage,
+	),
+	triggers.NewCommand(
+		"incident_export",
+		`(?P<id>\d+)(?:\s+(?P<format>json|csv))?\s*$`,
+		"Exports an incident and its timeline to a file, in JSON (the default) or CSV",
+		true,
+		true,
+		exportIncident,
+	),
+	triggers.NewCommand(
+		"incident_action",
+		`(?P<id>\d+)\s+(?P<action>add|done)\s+(?P<value>.+?)\s*$`,
+		"Adds a follow-up action item to an incident (add <owner> <text>), or marks one as done (done <n>)",
+		true,
+		false,
+		incidentAction,
+	),
+	triggers.NewCommand(
+		"actions",
+		`(?:\s+(?P<owner>\S+))?\s*$`,
+		"Lists the open action items of all incidents, optionally only those of an owner",
+		true,
+		true,
+		listActions,
+	),
+	triggers.NewCommand(
+		"incident_comms",
+		`(?P<id>\d+)\s+(?P<action>draft|approve|publish|show)(?:\s+(?P<text>.+?))?\s*$`,
+		"Drafts, approves and publishes public communications about an incident",
+		true,
+		false,
+		incidentComms,
+	),
 	triggers.NewCommand(
 		"incident_close",
 		"(?P<id>\\d+)$",
@@ -28,6 +100,70 @@ var IrcCommands = []*triggers.Command{
 		false,
 		stopIncident,
 	),
+	triggers.NewCommand(
+		"maintenance_schedule",
+		`(?P<start>\S+)\s+(?P<end>\S+)\s+(?P<components_comma_sep>[^,\s]+(?:,\s*[^,\s]+)*)\s+(?P<description>.+)$`,
+		"Schedules a maintenance window. Times are in the format 2006-01-02T15:04 (UTC)",
+		true,
+		false,
+		scheduleMaintenance,
+	),
+	triggers.NewCommand(
+		"maintenance_cancel",
+		"(?P<id>M?\\d+)$",
+		"Cancels a maintenance window",
+		true,
+		false,
+		cancelMaintenance,
+	),
+	triggers.NewCommand(
+		"maintenances",
+		"",
+		"Shows the scheduled maintenance windows",
+		true,
+		true,
+		listMaintenances,
+	),
+	triggers.NewCommand(
+		"component_add",
+		`(?P<team>\S+)\s+(?P<visibility>public|internal)\s+(?P<name_and_aliases_comma_sep>.+)$`,
+		"Adds a component to the catalog, or updates it. The name can be followed by a comma-separated list of aliases",
+		true,
+		true,
+		addComponent,
+	),
+	triggers.NewCommand(
+		"component_list",
+		"",
+		"Lists the components in the catalog",
+		true,
+		true,
+		listComponents,
+	),
+	triggers.NewCommand(
+		"incident_report",
+		"(?P<id>\\d+)$",
+		"Gets the postmortem report of a closed incident, writing it if needed.",
+		true,
+		true,
+		showReport,
+	),
+	triggers.NewCommand(
+		"incident_stats",
+		`(?:\s+(?P<since>\S+))?\s*$`,
+		"Shows statistics about the incidents, optionally since a date (2006-01-02), a number of days (90d) or a duration (12h)",
+		true,
+		true,
+		showStats,
+	),
+	triggers.NewCommand(
+		"incident_search",
+		`(?P<query>.+?)(?:\s+page\s+(?P<page>\d+))?\s*$`,
+		"Searches all incidents, open or closed. The query can contain words, components and a date range (2026-01-01..2026-03-31)",
+		true,
+		true,
+		searchIncidents,
+	),
 	triggers.NewCommand(
 		"incidents",
 		"",
@@ -45,3 +181,10 @@ var IrcCommands = []*triggers.Command{
 		formatIncident,
 	),
 }
+
+func init() {
+	// Every message is handled in its own goroutine.
+	for _, cmd := range IrcCommands {
+		cmd.Action = serialized(cmd.Action)
+	}
+}
@@ -0,0 +1,34 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+)
+
+// commandTest is a message sent to a command, and the arguments it should get.
+// Messages that don't match the format of the command get nil arguments.
+type commandTest struct {
+	content string
+	args    []string
+}
+
+// testCommand checks the arguments the command extracts from each message.
+func testCommand(t *testing.T, name string, tests []commandTest) {
+	t.Helper()
+	for _, cmd := range IrcCommands {
+		if cmd.ID != name {
+			continue
+		}
+		for _, tt := range tests {
+			var args []string
+			if matches := cmd.ArgumentsRegexp.FindStringSubmatch(tt.content); matches != nil {
+				args = matches[1:]
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("%q: got arguments %q, want %q", tt.content, args, tt.args)
+			}
+		}
+		return
+	}
+	t.Fatalf("Unknown command %s", name)
+}
@@ -0,0 +1,284 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/publisher"
+	"blabber/triggers"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Comms is a communication about an incident, meant for the outside world.
+// It goes from draft to approved to published.
+type Comms struct {
+	ID          int64
+	IncidentID  int64
+	Text        string
+	Author      string
+	CreatedAt   time.Time
+	ApprovedBy  string
+	ApprovedAt  time.Time
+	PublishedAt time.Time
+	// Publishers the message was pushed through, see publisherKey. The message is only
+	// published once all the configured publishers succeeded.
+	PublishedTo []string
+}
+
+// IsApproved tells you if the draft was approved.
+func (cm *Comms) IsApproved() bool {
+	return cm.ApprovedBy != ""
+}
+
+// IsPublished tells you if the message was published.
+func (cm *Comms) IsPublished() bool {
+	return !cm.PublishedAt.IsZero()
+}
+
+// String formats the message and its state, for IRC.
+func (cm *Comms) String() string {
+	var state string
+	switch {
+	case cm.IsPublished():
+		state = fmt.Sprintf("published at %s", cm.PublishedAt.Format("15:04 Jan 2"))
+	case cm.IsApproved():
+		state = fmt.Sprintf("approved by %s", cm.ApprovedBy)
+	default:
+		state = "waiting for approval"
+	}
+	return fmt.Sprintf("Draft by %s (%s): %s", cm.Author, state, cm.Text)
+}
+
+// formatOptionalTime formats a time for the database, using an empty string for the zero time.
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseOptionalTime parses a time formatted with formatOptionalTime.
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Save persists the message to the database.
+func (cm *Comms) Save(db *sql.DB) error {
+	var query string
+	if cm.ID == 0 {
+		query = "INSERT INTO incident_comms (incident_id, text, author, created_at, approved_by, approved_at, published_at, published_to) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	} else {
+		query = "UPDATE incident_comms SET incident_id=?, text=?, author=?, created_at=?, approved_by=?, approved_at=?, published_at=?, published_to=? WHERE id = ?"
+	}
+	statement, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{cm.IncidentID, cm.Text, cm.Author, cm.CreatedAt.Format(time.RFC3339), cm.ApprovedBy,
+		formatOptionalTime(cm.ApprovedAt), formatOptionalTime(cm.PublishedAt), strings.Join(cm.PublishedTo, " ")}
+	if cm.ID != 0 {
+		_, err = statement.Exec(append(args, cm.ID)...)
+		return err
+	}
+	result, err := statement.Exec(args...)
+	if err != nil {
+		return err
+	}
+	cm.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetCurrentDraft returns the last draft of a communication about the incident, or nil if there's none.
+// Published messages are not drafts anymore.
+func GetCurrentDraft(db *sql.DB, incidentID int64) (*Comms, error) {
+	cm := Comms{}
+	var created, approved, published, publishedTo string
+	err := db.QueryRow(
+		"SELECT id, incident_id, text, author, created_at, approved_by, approved_at, published_at, IFNULL(published_to, '') FROM incident_comms WHERE incident_id = ? ORDER BY id DESC LIMIT 1",
+		incidentID).Scan(&cm.ID, &cm.IncidentID, &cm.Text, &cm.Author, &created, &cm.ApprovedBy, &approved, &published, &publishedTo)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if cm.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+		return nil, err
+	}
+	if cm.ApprovedAt, err = parseOptionalTime(approved); err != nil {
+		return nil, err
+	}
+	if cm.PublishedAt, err = parseOptionalTime(published); err != nil {
+		return nil, err
+	}
+	if cm.IsPublished() {
+		return nil, nil
+	}
+	cm.PublishedTo = strings.Fields(publishedTo)
+	return &cm, nil
+}
+
+// canApprove tells you if the author of the message is in the ACL of the approvers.
+// Like in any ACL, incident roles can be used, e.g. "@comms".
+func canApprove(args []string, m *hbot.Message, db *sql.DB, c *bot.Configuration) bool {
+	acl, err := triggers.GetACL(c.CommsApprovers, db, c)
+	if err != nil {
+		log.Error("Couldn't fetch the ACLs", "error", err.Error())
+	}
+	resolvers := make(map[string]triggers.RoleResolver)
+	for _, role := range Roles {
+		resolvers[role] = RoleHolder(role)
+	}
+	return acl.IsAllowed(m) || acl.HasRole(args, m, db, resolvers)
+}
+
+// publisherKey identifies a publisher of the configuration, to remember the message was pushed through it.
+func publisherKey(conf bot.PublisherConfig) string {
+	return conf.Type + ":" + conf.URL + conf.Path
+}
+
+// isPublishedTo tells you if the message was already pushed through the publisher.
+func (cm *Comms) isPublishedTo(key string) bool {
+	for _, done := range cm.PublishedTo {
+		if done == key {
+			return true
+		}
+	}
+	return false
+}
+
+// publishComms pushes the message through all the configured publishers it wasn't pushed through yet,
+// and records the ones that succeeded: the message is published once none of them fails.
+// Like on the status page, only the public components are mentioned.
+func publishComms(db *sql.DB, c *bot.Configuration, inc *Incident, cm *Comms) error {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		return err
+	}
+	public := make(map[string]bool)
+	for _, comp := range components {
+		public[comp.Name] = comp.Public
+	}
+	var names []string
+	for _, name := range inc.components {
+		if public[name] {
+			names = append(names, name)
+		}
+	}
+	msg := publisher.Message{
+		IncidentID:  inc.ID,
+		Components:  names,
+		Text:        cm.Text,
+		Author:      cm.Author,
+		ApprovedBy:  cm.ApprovedBy,
+		PublishedAt: time.Now(),
+	}
+	if len(c.CommsPublishers) == 0 {
+		return fmt.Errorf("No publishers are configured")
+	}
+	var failed []string
+	for _, conf := range c.CommsPublishers {
+		key := publisherKey(conf)
+		if cm.isPublishedTo(key) {
+			continue
+		}
+		p, err := publisher.New(conf)
+		if err == nil {
+			err = p.Publish(&msg)
+		}
+		if err != nil {
+			log.Error("Could not publish the message", "publisher", conf.Type, "error", err, "incident", inc.ID)
+			failed = append(failed, conf.Type)
+			continue
+		}
+		cm.PublishedTo = append(cm.PublishedTo, key)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not publish the message with: %s", strings.Join(failed, ", "))
+	}
+	cm.PublishedAt = msg.PublishedAt
+	return nil
+}
+
+// IRC actions
+func incidentComms(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	draft, err := GetCurrentDraft(db, inc.ID)
+	if err != nil {
+		irc.Reply(m, "Could not fetch the draft, please check the logs for errors")
+		log.Error("Could not fetch the draft", "error", err, "incident", inc.ID)
+		return true
+	}
+	action, text := args[1], args[2]
+	if action == "draft" {
+		if text == "" {
+			irc.Reply(m, fmt.Sprintf("Please give the text of the message: !incident_comms %d draft <text>", inc.ID))
+			return true
+		}
+		draft = &Comms{IncidentID: inc.ID, Text: text, Author: m.Name, CreatedAt: time.Now()}
+		if err := draft.Save(db); err != nil {
+			irc.Reply(m, "Could not save the draft, please check the logs for errors")
+			log.Error("Could not save the draft", "error", err, "incident", inc.ID)
+			return true
+		}
+		irc.Reply(m, fmt.Sprintf("Draft saved. It needs to be approved with !incident_comms %d approve", inc.ID))
+		return true
+	}
+	if draft == nil {
+		irc.Reply(m, fmt.Sprintf("There is no draft for incident %d.", inc.ID))
+		return true
+	}
+	switch action {
+	case "show":
+		irc.Reply(m, draft.String())
+		return true
+	case "approve":
+		if draft.IsApproved() {
+			irc.Reply(m, fmt.Sprintf("The draft was already approved by %s.", draft.ApprovedBy))
+			return true
+		}
+		if draft.Author == m.Name {
+			irc.Reply(m, "You cannot approve your own draft.")
+			return true
+		}
+		if !canApprove(args, m, db, c) {
+			irc.Reply(m, "You're not allowed to approve communications.")
+			return true
+		}
+		draft.ApprovedBy = m.Name
+		draft.ApprovedAt = time.Now()
+		inc.AddEvent(EventComms, m.Name, "approved: "+draft.Text)
+	case "publish":
+		if !draft.IsApproved() {
+			irc.Reply(m, "The draft must be approved before being published.")
+			return true
+		}
+		if err := publishComms(db, c, inc, draft); err != nil {
+			// Remember the publishers that succeeded, so that they're not used again on the next attempt.
+			if err := draft.Save(db); err != nil {
+				log.Error("Could not save the draft", "error", err, "incident", inc.ID)
+			}
+			irc.Reply(m, fmt.Sprintf("%s, please check the logs for errors. Run !incident_comms %d publish again to retry.", err, inc.ID))
+			return true
+		}
+		inc.AddEvent(EventComms, m.Name, "published: "+draft.Text)
+	}
+	if err := draft.Save(db); err != nil {
+		irc.Reply(m, "Could not save the draft, please check the logs for errors")
+		log.Error("Could not save the draft", "error", err, "incident", inc.ID)
+		return true
+	}
+	if saveIncident(inc, db, irc, m, c) {
+		irc.Reply(m, draft.String())
+	}
+	return true
+}
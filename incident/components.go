@@ -0,0 +1,174 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Component is something that can break, as defined in the
+// configuration or in the database.
+type Component struct {
+	Name    string
+	Aliases []string
+	Team    string
+	Public  bool
+}
+
+// newComponent creates a component from its configuration.
+func newComponent(conf bot.ComponentConfig) *Component {
+	return &Component{Name: conf.Name, Aliases: conf.Aliases, Team: conf.Team, Public: conf.Public}
+}
+
+// Matches tells you if a name refers to the component, either directly or via an alias.
+func (comp *Component) Matches(name string) bool {
+	if strings.EqualFold(comp.Name, name) {
+		return true
+	}
+	for _, alias := range comp.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the component for IRC.
+func (comp *Component) String() string {
+	visibility := "internal"
+	if comp.Public {
+		visibility = "public"
+	}
+	desc := fmt.Sprintf("%s (%s, owned by %s)", comp.Name, visibility, comp.Team)
+	if len(comp.Aliases) > 0 {
+		desc += fmt.Sprintf(" aka %s", strings.Join(comp.Aliases, ", "))
+	}
+	return desc
+}
+
+// Save persists the component to the database, replacing any component with the same name.
+func (comp *Component) Save(db *sql.DB) error {
+	statement, err := db.Prepare("INSERT OR REPLACE INTO components (name, aliases, team, public) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(comp.Name, strings.Join(comp.Aliases, ", "), comp.Team, comp.Public)
+	return err
+}
+
+// conflict returns the name or alias of the component also used by the other one, if any.
+func (comp *Component) conflict(other *Component) string {
+	for _, name := range append([]string{comp.Name}, comp.Aliases...) {
+		if other.Matches(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// GetComponents returns the component catalog: the components defined in the
+// configuration, plus the ones stored in the database. The latter take
+// precedence if the same name is used in both.
+func GetComponents(db *sql.DB, c *bot.Configuration) ([]*Component, error) {
+	byName := make(map[string]*Component)
+	for _, conf := range c.Components {
+		byName[strings.ToLower(conf.Name)] = newComponent(conf)
+	}
+	statement, err := db.Prepare("SELECT name, aliases, team, public FROM components")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		comp := Component{}
+		var aliases string
+		if err := rows.Scan(&comp.Name, &aliases, &comp.Team, &comp.Public); err != nil {
+			return nil, err
+		}
+		if aliases != "" {
+			comp.Aliases = strings.Split(aliases, ", ")
+		}
+		byName[strings.ToLower(comp.Name)] = &comp
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var components []*Component
+	for _, comp := range byName {
+		components = append(components, comp)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+	return components, nil
+}
+
+// LookupComponent finds a component in the catalog by name or alias.
+func LookupComponent(db *sql.DB, c *bot.Configuration, name string) (*Component, error) {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, comp := range components {
+		if comp.Matches(strings.TrimSpace(name)) {
+			return comp, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown component '%s'", name)
+}
+
+// IRC actions
+func addComponent(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	splitRegex := regexp.MustCompile(",\\s*")
+	names := splitRegex.Split(strings.TrimSpace(args[2]), -1)
+	comp := Component{Name: names[0], Aliases: names[1:], Team: args[0], Public: args[1] == "public"}
+	components, err := GetComponents(db, c)
+	if err != nil {
+		irc.Reply(m, "Could not retrieve the list of components. Please check the logs")
+		log.Error("Could not retrieve the list of components", "error", err)
+		return true
+	}
+	for _, other := range components {
+		// The component being updated, if it exists already.
+		if strings.EqualFold(other.Name, comp.Name) {
+			continue
+		}
+		if name := comp.conflict(other); name != "" {
+			irc.Reply(m, fmt.Sprintf("'%s' already refers to the component %s", name, other.Name))
+			return true
+		}
+	}
+	if err := comp.Save(db); err != nil {
+		irc.Reply(m, "Could not save the component, please check the logs for errors")
+		log.Error("Could not save the component", "error", err, "component", comp.Name)
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("Component saved: %s", comp.String()))
+	return true
+}
+
+func listComponents(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		irc.Reply(m, "Could not retrieve the list of components. Please check the logs")
+		log.Error("Could not retrieve the list of components", "error", err)
+		return true
+	}
+	if len(components) == 0 {
+		irc.Reply(m, "No components defined yet.")
+		return true
+	}
+	irc.Reply(m, "Components:")
+	for _, comp := range components {
+		irc.Reply(m, fmt.Sprintf("  * %s", comp.String()))
+	}
+	return true
+}
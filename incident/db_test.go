@@ -0,0 +1,30 @@
+package incident
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns an in-memory database created from schema.sql.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	schema, err := ioutil.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to an in-memory database gets its own database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(string(schema)); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,178 @@
+package incident
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// documentUpdateExpiry is how long failing updates are retried. After that, the document
+// is considered gone (e.g. deleted), and its pending updates are dropped so that they
+// don't stay in the queue forever.
+const documentUpdateExpiry = 24 * time.Hour
+
+// DocumentUpdate is a line of text waiting to be added to an incident document.
+// Updates are queued in the database, so that they can be retried if the
+// backend is not available.
+type DocumentUpdate struct {
+	ID         int64
+	DocumentID string
+	Text       string
+	Attempts   int64
+	CreatedAt  time.Time
+}
+
+// Save queues the update in the database.
+func (u *DocumentUpdate) Save(db Querier) error {
+	statement, err := db.Prepare("INSERT INTO document_updates (document_id, text, attempts, created_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	result, err := statement.Exec(u.DocumentID, u.Text, u.Attempts, u.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	u.ID, err = result.LastInsertId()
+	return err
+}
+
+func (u *DocumentUpdate) remove(db *sql.DB) error {
+	statement, err := db.Prepare("DELETE FROM document_updates WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(u.ID)
+	return err
+}
+
+func (u *DocumentUpdate) failed(db *sql.DB) error {
+	u.Attempts++
+	statement, err := db.Prepare("UPDATE document_updates SET attempts = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(u.Attempts, u.ID)
+	return err
+}
+
+// expired tells you if the update kept failing for too long to be retried.
+func (u *DocumentUpdate) expired() bool {
+	return u.Attempts > 0 && time.Since(u.CreatedAt) > documentUpdateExpiry
+}
+
+// dropDocumentUpdates removes all the pending updates of a document.
+func dropDocumentUpdates(db *sql.DB, documentID string) error {
+	statement, err := db.Prepare("DELETE FROM document_updates WHERE document_id = ?")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(documentID)
+	return err
+}
+
+// GetPendingDocumentUpdates returns all the queued updates, oldest first.
+func GetPendingDocumentUpdates(db *sql.DB) ([]*DocumentUpdate, error) {
+	statement, err := db.Prepare("SELECT id, document_id, text, attempts, created_at FROM document_updates ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var updates []*DocumentUpdate
+	for rows.Next() {
+		u := DocumentUpdate{}
+		var created string
+		if err := rows.Scan(&u.ID, &u.DocumentID, &u.Text, &u.Attempts, &created); err != nil {
+			return nil, err
+		}
+		if u.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, err
+		}
+		updates = append(updates, &u)
+	}
+	return updates, rows.Err()
+}
+
+// queueDocumentUpdate adds a line of text to the queue of updates for the incident document.
+// The update is queued even if the document could not be fetched, to be retried later.
+func (i *Incident) queueDocumentUpdate(db Querier, text string) error {
+	documentID := i.DocumentID()
+	if documentID == "" {
+		return nil
+	}
+	u := DocumentUpdate{DocumentID: documentID, Text: text, CreatedAt: time.Now()}
+	return u.Save(db)
+}
+
+// Only one goroutine at a time should be sending the updates, or
+// we could end up adding them twice.
+var docSyncLock sync.Mutex
+
+// FlushDocumentUpdates tries to add all the queued updates to their documents.
+// Updates that fail are kept in the queue, and so are all the following updates
+// for the same document, so that their order is preserved. Once the oldest update of a
+// document has been failing for longer than documentUpdateExpiry, all the updates of
+// that document are dropped.
+func FlushDocumentUpdates(db *sql.DB) error {
+	docSyncLock.Lock()
+	defer docSyncLock.Unlock()
+	updates, err := GetPendingDocumentUpdates(db)
+	if err != nil {
+		return err
+	}
+	documents := make(map[string]RemoteDocument)
+	failed := make(map[string]bool)
+	for _, u := range updates {
+		if failed[u.DocumentID] {
+			continue
+		}
+		var err error
+		doc, ok := documents[u.DocumentID]
+		if !ok {
+			doc = NewDocument()
+			if doc == nil {
+				// Documents are disabled or the backend is not reachable.
+				return nil
+			}
+			if err = doc.GetFromId(u.DocumentID); err == nil {
+				documents[u.DocumentID] = doc
+			}
+		}
+		if err == nil {
+			err = doc.Append(u.Text)
+		}
+		if err != nil {
+			failed[u.DocumentID] = true
+			if u.expired() {
+				log.Error("Giving up on the updates of the document", "id", u.DocumentID, "since", u.CreatedAt, "error", err)
+				if err := dropDocumentUpdates(db, u.DocumentID); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Error("Could not update the document, will retry", "id", u.DocumentID, "attempts", u.Attempts+1, "error", err)
+			if err := u.failed(db); err != nil {
+				log.Error("Could not record the failed document update", "id", u.ID, "error", err)
+			}
+			continue
+		}
+		if err := u.remove(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncDocuments periodically retries the queued document updates. It never returns.
+func SyncDocuments(db *sql.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := FlushDocumentUpdates(db); err != nil {
+			log.Error("Could not flush the document updates", "error", err)
+		}
+	}
+}
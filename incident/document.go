@@ -0,0 +1,69 @@
+package incident
+
+import (
+	"blabber/bot"
+	"fmt"
+)
+
+// RemoteDocument is a simple interface for
+// Interacting with different type of documents
+type RemoteDocument interface {
+	// Gets the remote document from a template
+	NewFromTemplate(title string, c *bot.Configuration) error
+	// Creates a new remote document with the given content
+	NewFromText(title string, content string, c *bot.Configuration) error
+	// Gets the remote document from its ID
+	GetFromId(documentID string) error
+	// Returns the url at which you can fetch the document.
+	Url() string
+	// Returns the unique ID that can be used for GetFromId later
+	Id() string
+	// Adds a line of text to the timeline of the document
+	Append(text string) error
+	// Replaces the whole content of the document
+	Replace(content string) error
+}
+
+// Available document backends
+const (
+	BackendGoogleDocs = "gdocs"
+	BackendMarkdown   = "markdown"
+	BackendNone       = "none"
+)
+
+// docConfig is the configuration used to create new documents.
+var docConfig = &bot.Configuration{DocBackend: BackendGoogleDocs}
+
+// SetDocumentBackend selects the backend used for incident documents
+// according to the configuration. The configuration is copied, not modified.
+func SetDocumentBackend(c *bot.Configuration) error {
+	conf := *c
+	switch conf.DocBackend {
+	case BackendMarkdown, BackendNone:
+	case BackendGoogleDocs, "":
+		conf.DocBackend = BackendGoogleDocs
+		// Check the sharing settings now, rather than after copying the template for a new incident.
+		if _, err := sharingPermissions(conf.DocSharing); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown document backend '%s'", c.DocBackend)
+	}
+	docConfig = &conf
+	return nil
+}
+
+// NewDocument returns a new, empty document for the configured backend.
+// It returns nil if documents are disabled or the backend is not available.
+func NewDocument() RemoteDocument {
+	switch docConfig.DocBackend {
+	case BackendGoogleDocs:
+		// Avoid returning a non-nil interface holding a nil pointer
+		if doc := NewGoogleDoc(); doc != nil {
+			return doc
+		}
+	case BackendMarkdown:
+		return NewMarkdownDoc(docConfig)
+	}
+	return nil
+}
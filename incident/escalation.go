@@ -0,0 +1,291 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/contact"
+	"blabber/notify"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// escalationAuthor is the author of the timeline entries added by the escalation policy.
+const escalationAuthor = "escalation"
+
+// Page is the state of the escalation policy for an incident.
+type Page struct {
+	IncidentID int64
+	// Index of the last tier paged. It's equal to the number of tiers once they were all paged in vain.
+	Tier    int64
+	PagedAt time.Time
+	AckedBy string
+	AckedAt time.Time
+}
+
+// IsAcked tells you if somebody acknowledged the page.
+func (p *Page) IsAcked() bool {
+	return p.AckedBy != ""
+}
+
+// Save persists the page to the database.
+func (p *Page) Save(db *sql.DB) error {
+	statement, err := db.Prepare("INSERT OR REPLACE INTO incident_pages (incident_id, tier, paged_at, acked_by, acked_at) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	var acked string
+	if p.IsAcked() {
+		acked = p.AckedAt.Format(time.RFC3339)
+	}
+	_, err = statement.Exec(p.IncidentID, p.Tier, p.PagedAt.Format(time.RFC3339), p.AckedBy, acked)
+	return err
+}
+
+// Delete removes the page, so that the incident can be paged again.
+func (p *Page) Delete(db *sql.DB) error {
+	statement, err := db.Prepare("DELETE FROM incident_pages WHERE incident_id = ?")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(p.IncidentID)
+	return err
+}
+
+func pageFromDbRows(rows *sql.Rows) (*Page, error) {
+	p := Page{}
+	var paged, acked string
+	if err := rows.Scan(&p.IncidentID, &p.Tier, &paged, &p.AckedBy, &acked); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.PagedAt, err = time.Parse(time.RFC3339, paged); err != nil {
+		return nil, err
+	}
+	if acked != "" {
+		if p.AckedAt, err = time.Parse(time.RFC3339, acked); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// GetPage returns the page of an incident, or nil if nobody was paged.
+func GetPage(db *sql.DB, incidentID int64) (*Page, error) {
+	statement, err := db.Prepare("SELECT incident_id, tier, paged_at, acked_by, acked_at FROM incident_pages WHERE incident_id = ?")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return pageFromDbRows(rows)
+}
+
+// getUnackedPages returns the pages nobody acknowledged yet.
+func getUnackedPages(db *sql.DB) ([]*Page, error) {
+	statement, err := db.Prepare("SELECT incident_id, tier, paged_at, acked_by, acked_at FROM incident_pages WHERE acked_by = ''")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pages []*Page
+	for rows.Next() {
+		p, err := pageFromDbRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+	return pages, rows.Err()
+}
+
+// ValidateEscalation checks the escalation policy when blabber starts, rather than when paging.
+func ValidateEscalation(db *sql.DB, c *bot.Configuration) error {
+	if len(c.Escalation.Tiers) == 0 {
+		return nil
+	}
+	if len(c.Escalation.Notifiers) == 0 {
+		return fmt.Errorf("The escalation policy has tiers, but no notifiers")
+	}
+	for _, conf := range c.Escalation.Notifiers {
+		if _, err := notify.New(conf); err != nil {
+			return fmt.Errorf("Invalid notifier in the escalation policy: %v", err)
+		}
+	}
+	for n, names := range c.Escalation.Tiers {
+		if len(names) == 0 {
+			return fmt.Errorf("Tier %d of the escalation policy is empty", n+1)
+		}
+		for _, name := range names {
+			if _, err := contact.GetContact(db, name); err != nil {
+				return fmt.Errorf("Unknown contact '%s' in tier %d of the escalation policy", name, n+1)
+			}
+		}
+	}
+	return nil
+}
+
+// getNotifiers returns the notifiers of the escalation policy.
+func getNotifiers(c *bot.Configuration) []notify.Notifier {
+	var notifiers []notify.Notifier
+	for _, conf := range c.Escalation.Notifiers {
+		n, err := notify.New(conf)
+		if err != nil {
+			log.Error("Invalid notifier", "type", conf.Type, "error", err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers
+}
+
+// pageTier notifies all the contacts of a tier about the incident, and records it in the timeline.
+// The incident still needs to be saved.
+func (i *Incident) pageTier(irc *hbot.Bot, db *sql.DB, c *bot.Configuration, tier int64) {
+	names := c.Escalation.Tiers[tier]
+	subject := fmt.Sprintf("Incident #%d, severity %d: %s", i.ID, i.severity, strings.Join(i.components, ", "))
+	message := fmt.Sprintf("%s. Acknowledge with !ack %d", i.Summary(false), i.ID)
+	notifiers := getNotifiers(c)
+	// Sending emails or text messages can be slow, don't block the bot.
+	go func(id int64) {
+		for _, name := range names {
+			ct, err := contact.GetContact(db, name)
+			if err != nil {
+				log.Error("Could not find the contact to page", "contact", name, "error", err)
+				continue
+			}
+			to := notify.Recipient{Name: ct.Name(), Phone: ct.Phone(), Email: ct.Email()}
+			for _, n := range notifiers {
+				if err := n.Notify(to, subject, message); err != nil && err != notify.ErrNoAddress {
+					log.Error("Could not page the contact", "contact", name, "incident", id, "error", err)
+				}
+			}
+		}
+	}(i.ID)
+	text := fmt.Sprintf("paged tier %d: %s", tier+1, strings.Join(names, ", "))
+	i.AddEvent(EventPage, escalationAuthor, text)
+	announce(irc, c, fmt.Sprintf("Incident #%d: %s", i.ID, text))
+}
+
+// escalate starts the escalation policy if the incident is severe enough, and nobody was paged yet.
+// Once the incident is closed or less severe, the page is reset, so that it's paged again if it gets worse.
+func (i *Incident) escalate(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) error {
+	if len(c.Escalation.Tiers) == 0 {
+		return nil
+	}
+	page, err := GetPage(db, i.ID)
+	if err != nil {
+		return err
+	}
+	if i.Status == StatusClosed || !SeverityAtLeast(i.severity, c.Escalation.Severity) {
+		if page != nil {
+			return page.Delete(db)
+		}
+		return nil
+	}
+	if page != nil {
+		return nil
+	}
+	page = &Page{IncidentID: i.ID, Tier: 0, PagedAt: time.Now()}
+	if err := page.Save(db); err != nil {
+		return err
+	}
+	i.pageTier(irc, db, c, 0)
+	return i.Save(db)
+}
+
+// checkEscalations pages the next tier for the incidents nobody acknowledged in time.
+func checkEscalations(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) error {
+	LockIncidents()
+	defer UnlockIncidents()
+	pages, err := getUnackedPages(db)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(c.Escalation.AckTimeout) * time.Minute
+	tiers := int64(len(c.Escalation.Tiers))
+	for _, page := range pages {
+		if page.Tier >= tiers || time.Since(page.PagedAt) < timeout {
+			continue
+		}
+		inc, err := getByID(db, page.IncidentID, false)
+		if err != nil || inc == nil || inc.Status == StatusClosed {
+			continue
+		}
+		page.Tier++
+		page.PagedAt = time.Now()
+		if err := page.Save(db); err != nil {
+			return err
+		}
+		if page.Tier == tiers {
+			announce(irc, c, fmt.Sprintf("Nobody acknowledged incident #%d, and there is nobody left to page!", inc.ID))
+			continue
+		}
+		inc.pageTier(irc, db, c, page.Tier)
+		if err := inc.Save(db); err != nil {
+			return err
+		}
+	}
+	go func() {
+		if err := FlushDocumentUpdates(db); err != nil {
+			log.Error("Could not flush the document updates", "error", err)
+		}
+	}()
+	return nil
+}
+
+// RunEscalations periodically escalates the pages nobody acknowledged. It never returns.
+func RunEscalations(irc *hbot.Bot, db *sql.DB, c *bot.Configuration, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := checkEscalations(irc, db, c); err != nil {
+			log.Error("Could not check the escalations", "error", err)
+		}
+	}
+}
+
+// IRC actions
+func ackPage(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	page, err := GetPage(db, inc.ID)
+	if err != nil {
+		irc.Reply(m, "Could not fetch the page, please check the logs for errors")
+		log.Error("Could not fetch the page", "error", err, "incident", inc.ID)
+		return true
+	}
+	if page == nil {
+		irc.Reply(m, fmt.Sprintf("Nobody was paged for incident %d.", inc.ID))
+		return true
+	}
+	if page.IsAcked() {
+		irc.Reply(m, fmt.Sprintf("The page for incident %d was already acknowledged by %s.", inc.ID, page.AckedBy))
+		return true
+	}
+	page.AckedBy = m.Name
+	page.AckedAt = time.Now()
+	if err := page.Save(db); err != nil {
+		irc.Reply(m, "Could not save the acknowledgement, please check the logs for errors")
+		log.Error("Could not save the acknowledgement", "error", err, "incident", inc.ID)
+		return true
+	}
+	inc.AddEvent(EventAck, m.Name, "")
+	if saveIncident(inc, db, irc, m, c) {
+		irc.Reply(m, fmt.Sprintf("Page for incident %d acknowledged, thanks %s!", inc.ID, m.Name))
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package incident
+
+import (
+	"blabber/bot"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func TestEscalation(t *testing.T) {
+	db := newTestDB(t)
+	paged := make(chan string, 10)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var sms map[string]string
+		json.NewDecoder(r.Body).Decode(&sms)
+		paged <- sms["to"]
+	}))
+	defer gateway.Close()
+	for _, contact := range []string{"alice", "bob", "carol"} {
+		if _, err := db.Exec("INSERT INTO contacts VALUES (?, ?, '')", contact, contact+"-phone"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &bot.Configuration{
+		Channels: []string{"#ops"},
+		Escalation: bot.EscalationConfig{
+			Severity:   2,
+			AckTimeout: 15,
+			Tiers:      [][]string{{"alice"}, {"bob", "carol"}},
+			Notifiers:  []bot.NotifierConfig{{Type: "http_sms", URL: gateway.URL}},
+		},
+	}
+	if err := ValidateEscalation(db, c); err != nil {
+		t.Fatal(err)
+	}
+	irc, err := hbot.NewBot("localhost:6667", "blabber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expectPaged checks who was paged since the last call.
+	expectPaged := func(want ...string) {
+		t.Helper()
+		var got []string
+		for range want {
+			select {
+			case to := <-paged:
+				got = append(got, to)
+			case <-time.After(5 * time.Second):
+			}
+		}
+		select {
+		case to := <-paged:
+			got = append(got, to)
+		case <-time.After(50 * time.Millisecond):
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got pages to %v, want %v", got, want)
+		}
+	}
+	// expectTier checks the tier paged last for the incident, -1 meaning not paged.
+	expectTier := func(inc *Incident, tier int64) {
+		t.Helper()
+		page, err := GetPage(db, inc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == nil && tier != -1 || page != nil && page.Tier != tier {
+			t.Errorf("incident %d: got page %+v, want tier %d", inc.ID, page, tier)
+		}
+	}
+	// timeout makes the page of the incident older than it is.
+	timeout := func(inc *Incident, elapsed time.Duration) {
+		t.Helper()
+		page, err := GetPage(db, inc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.PagedAt = time.Now().Add(-elapsed)
+		if err := page.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inc := &Incident{severity: 3, components: []string{"Website"}, Status: StatusOpen, startedAt: time.Now(), updatedAt: time.Now()}
+	if err := inc.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := inc.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(inc, -1)
+	expectPaged()
+
+	// Getting worse pages the first tier.
+	inc.SetSeverity(2, "alice")
+	if err := inc.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(inc, 0)
+	expectPaged("alice-phone")
+
+	// The next tiers are paged when nobody acknowledges in time.
+	steps := []struct {
+		elapsed time.Duration
+		tier    int64
+		paged   []string
+	}{
+		{14 * time.Minute, 0, nil},
+		{16 * time.Minute, 1, []string{"bob-phone", "carol-phone"}},
+		{time.Minute, 1, nil},
+		// Nobody is left to page.
+		{16 * time.Minute, 2, nil},
+		{time.Hour, 2, nil},
+	}
+	for _, step := range steps {
+		timeout(inc, step.elapsed)
+		if err := checkEscalations(irc, db, c); err != nil {
+			t.Fatal(err)
+		}
+		expectTier(inc, step.tier)
+		expectPaged(step.paged...)
+	}
+	timeline, err := inc.Timeline(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []string
+	for _, e := range timeline {
+		if e.Kind == EventPage {
+			pages = append(pages, e.Text)
+		}
+	}
+	if want := []string{"paged tier 1: alice", "paged tier 2: bob, carol"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("got pages %q in the timeline, want %q", pages, want)
+	}
+
+	// Acknowledged pages are not escalated.
+	acked := &Incident{severity: 1, components: []string{"Search"}, Status: StatusOpen, startedAt: time.Now(), updatedAt: time.Now()}
+	if err := acked.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := acked.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectPaged("alice-phone")
+	page, err := GetPage(db, acked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.AckedBy, page.AckedAt = "alice", time.Now()
+	page.PagedAt = time.Now().Add(-time.Hour)
+	if err := page.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEscalations(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(acked, 0)
+	expectPaged()
+
+	// Once the incident is less severe, the page is reset, and it's paged again if it gets worse.
+	acked.SetSeverity(3, "alice")
+	if err := acked.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(acked, -1)
+	acked.SetSeverity(2, "alice")
+	if err := acked.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(acked, 0)
+	expectPaged("alice-phone")
+
+	// Closed incidents are never escalated.
+	acked.Close("alice")
+	if err := acked.escalate(irc, db, c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(acked, -1)
+	expectPaged()
+}
+
+func TestValidateEscalation(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("INSERT INTO contacts VALUES ('alice', '123', 'alice@example.org')"); err != nil {
+		t.Fatal(err)
+	}
+	smtp := bot.NotifierConfig{Type: "smtp", SMTPServer: "localhost:25", From: "blabber@example.org"}
+	tests := []struct {
+		name       string
+		escalation bot.EscalationConfig
+		valid      bool
+	}{
+		{"no tiers", bot.EscalationConfig{}, true},
+		{"valid", bot.EscalationConfig{Tiers: [][]string{{"alice"}}, Notifiers: []bot.NotifierConfig{smtp}}, true},
+		{"no notifiers", bot.EscalationConfig{Tiers: [][]string{{"alice"}}}, false},
+		{"invalid notifier", bot.EscalationConfig{Tiers: [][]string{{"alice"}}, Notifiers: []bot.NotifierConfig{{Type: "pigeon"}}}, false},
+		{"empty tier", bot.EscalationConfig{Tiers: [][]string{{"alice"}, {}}, Notifiers: []bot.NotifierConfig{smtp}}, false},
+		{"unknown contact", bot.EscalationConfig{Tiers: [][]string{{"alice", "bob"}}, Notifiers: []bot.NotifierConfig{smtp}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEscalation(db, &bot.Configuration{Escalation: tt.escalation})
+			if tt.valid != (err == nil) {
+				t.Errorf("got error %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Formats of the exported incidents.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// csvHeader lists the columns of the CSV export. The timeline is a single column,
+// with one event per line, and the fields of the event separated by tabs.
+var csvHeader = []string{"id", "severity", "status", "components", "description", "started_at", "updated_at", "document_id", "channel", "impact", "timeline"}
+
+// ExportedEvent is an entry of the timeline of an exported incident.
+type ExportedEvent struct {
+	Kind      string    `json:"kind"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	Text      string    `json:"text"`
+}
+
+// ExportedIncident is the serializable representation of an incident and its timeline.
+type ExportedIncident struct {
+	ID          int64            `json:"id"`
+	Severity    int64            `json:"severity"`
+	Status      string           `json:"status"`
+	Components  []string         `json:"components"`
+	Description string           `json:"description"`
+	StartedAt   time.Time        `json:"started_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	DocumentID  string           `json:"document_id"`
+	Channel     string           `json:"channel"`
+	Impact      Impact           `json:"impact"`
+	Timeline    []*ExportedEvent `json:"timeline"`
+}
+
+// Export returns the serializable representation of the incident, including its timeline.
+func (i *Incident) Export(db *sql.DB) (*ExportedIncident, error) {
+	events, err := i.Timeline(db)
+	if err != nil {
+		return nil, err
+	}
+	e := ExportedIncident{
+		ID:          i.ID,
+		Severity:    i.severity,
+		Status:      StatusName(i.Status),
+		Components:  i.components,
+		Description: i.Description,
+		StartedAt:   i.startedAt,
+		UpdatedAt:   i.updatedAt,
+		DocumentID:  i.DocumentID(),
+		Channel:     i.Channel,
+		Impact:      i.Impact,
+		Timeline:    []*ExportedEvent{},
+	}
+	for _, ev := range events {
+		e.Timeline = append(e.Timeline, &ExportedEvent{Kind: ev.Kind, Author: ev.Author, CreatedAt: ev.CreatedAt, Text: ev.Text})
+	}
+	return &e, nil
+}
+
+// ExportIncidents returns all the incidents started since the given time, oldest first.
+// Use the zero time to export all the incidents.
+func ExportIncidents(db *sql.DB, since time.Time) ([]*ExportedIncident, error) {
+	incidents, err := getAllIncidents(db)
+	if err != nil {
+		return nil, err
+	}
+	exported := []*ExportedIncident{}
+	for _, inc := range incidents {
+		if inc.startedAt.Before(since) {
+			continue
+		}
+		e, err := inc.Export(db)
+		if err != nil {
+			return nil, err
+		}
+		exported = append(exported, e)
+	}
+	return exported, nil
+}
+
+// formatTimeline formats the timeline for the CSV export.
+func formatTimeline(events []*ExportedEvent) string {
+	var lines []string
+	for _, ev := range events {
+		text := strings.NewReplacer("\t", " ", "\n", " ").Replace(ev.Text)
+		lines = append(lines, strings.Join([]string{ev.CreatedAt.Format(time.RFC3339), ev.Kind, ev.Author, text}, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseTimeline parses a timeline formatted with formatTimeline.
+func parseTimeline(value string) ([]*ExportedEvent, error) {
+	events := []*ExportedEvent{}
+	if value == "" {
+		return events, nil
+	}
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Invalid timeline entry '%s'", line)
+		}
+		created, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &ExportedEvent{Kind: fields[1], Author: fields[2], CreatedAt: created, Text: fields[3]})
+	}
+	return events, nil
+}
+
+// WriteExport serializes the incidents in the given format.
+func WriteExport(w io.Writer, incidents []*ExportedIncident, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(incidents)
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, e := range incidents {
+			record := []string{
+				strconv.FormatInt(e.ID, 10),
+				strconv.FormatInt(e.Severity, 10),
+				e.Status,
+				strings.Join(e.Components, ", "),
+				e.Description,
+				e.StartedAt.Format(time.RFC3339),
+				e.UpdatedAt.Format(time.RFC3339),
+				e.DocumentID,
+				e.Channel,
+				e.Impact.Args(),
+				formatTimeline(e.Timeline),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("Unknown export format '%s'", format)
+	}
+}
+
+// ReadExport parses incidents serialized by WriteExport, or produced by another tracker in the same format.
+func ReadExport(r io.Reader, format string) ([]*ExportedIncident, error) {
+	switch format {
+	case FormatJSON:
+		var incidents []*ExportedIncident
+		if err := json.NewDecoder(r).Decode(&incidents); err != nil {
+			return nil, fmt.Errorf("Could not parse the JSON export: %v", err)
+		}
+		return incidents, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse the CSV export: %v", err)
+		}
+		var incidents []*ExportedIncident
+		// The first line is the header.
+		for n, record := range records {
+			if n == 0 {
+				continue
+			}
+			e, err := incidentFromCSV(record)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse line %d of the CSV export: %v", n+1, err)
+			}
+			incidents = append(incidents, e)
+		}
+		return incidents, nil
+	default:
+		return nil, fmt.Errorf("Unknown export format '%s'", format)
+	}
+}
+
+func incidentFromCSV(record []string) (*ExportedIncident, error) {
+	e := ExportedIncident{Status: record[2], Description: record[4], DocumentID: record[7], Channel: record[8]}
+	var err error
+	if record[0] != "" {
+		if e.ID, err = strconv.ParseInt(record[0], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if e.Severity, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(record[3], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			e.Components = append(e.Components, name)
+		}
+	}
+	if e.StartedAt, err = time.Parse(time.RFC3339, record[5]); err != nil {
+		return nil, err
+	}
+	if e.UpdatedAt, err = time.Parse(time.RFC3339, record[6]); err != nil {
+		return nil, err
+	}
+	if record[9] != "" {
+		// Regions are not validated, historical incidents may affect regions that don't exist anymore.
+		if e.Impact, err = ParseImpact(record[9], Impact{}, &bot.Configuration{}); err != nil {
+			return nil, err
+		}
+	}
+	if e.Timeline, err = parseTimeline(record[10]); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Import saves an exported incident as a new incident, with its own timeline.
+// Components are normalized if they are in the catalog, and kept as they are otherwise,
+// as historical incidents may refer to components that don't exist anymore. The channel
+// is not imported, since the bot never joined it. An incident already imported, with the
+// same id and start time, is skipped: nil is returned then.
+func (e *ExportedIncident) Import(db *sql.DB, c *bot.Configuration) (*Incident, error) {
+	if !ValidSeverity(e.Severity) {
+		return nil, fmt.Errorf("Severity must be between 1 and 5")
+	}
+	if len(e.Components) == 0 {
+		return nil, fmt.Errorf("The incident has no components")
+	}
+	status, err := ParseStatus(e.Status)
+	if err != nil {
+		return nil, err
+	}
+	inc := Incident{
+		severity:    e.Severity,
+		startedAt:   e.StartedAt,
+		updatedAt:   e.UpdatedAt,
+		Description: e.Description,
+		Status:      status,
+		documentID:  e.DocumentID,
+		Impact:      e.Impact,
+	}
+	if inc.updatedAt.IsZero() {
+		inc.updatedAt = inc.startedAt
+	}
+	for _, name := range e.Components {
+		if comp, err := LookupComponent(db, c, name); err == nil {
+			name = comp.Name
+		}
+		inc.components = append(inc.components, name)
+	}
+	// The incident and its timeline are imported completely, or not at all.
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.importInto(tx, &inc); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if inc.ID == 0 {
+		return nil, nil
+	}
+	return &inc, nil
+}
+
+func (e *ExportedIncident) importInto(db Querier, inc *Incident) error {
+	// Incidents without an id can't be told apart, they are always imported.
+	if e.ID != 0 {
+		var id int64
+		err := db.QueryRow("SELECT incident_id FROM imported_incidents WHERE source_id = ? AND started_at = ?",
+			e.ID, e.StartedAt.Format(time.RFC3339)).Scan(&id)
+		if err == nil {
+			return nil
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	if err := inc.Save(db); err != nil {
+		return err
+	}
+	// The events are saved directly: the document already contains them, they must not be queued for it again.
+	for _, ev := range e.Timeline {
+		event := Event{IncidentID: inc.ID, Kind: ev.Kind, Author: ev.Author, CreatedAt: ev.CreatedAt, Text: ev.Text}
+		if err := event.Save(db); err != nil {
+			return err
+		}
+	}
+	if err := indexIncident(db, inc); err != nil {
+		log.Error("Could not index the incident for search", "error", err, "incident", inc.ID)
+	}
+	if e.ID == 0 {
+		return nil
+	}
+	statement, err := db.Prepare("INSERT INTO imported_incidents (source_id, started_at, incident_id) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(e.ID, e.StartedAt.Format(time.RFC3339), inc.ID)
+	return err
+}
+
+// ImportIncidents saves all the exported incidents as new incidents, skipping the ones
+// already imported. It stops at the first error, and returns the number of incidents
+// imported and skipped so far.
+func ImportIncidents(db *sql.DB, c *bot.Configuration, incidents []*ExportedIncident) (imported int, skipped int, err error) {
+	for _, e := range incidents {
+		inc, err := e.Import(db, c)
+		if err != nil {
+			return imported, skipped, fmt.Errorf("Could not import incident %d: %v", e.ID, err)
+		}
+		if inc == nil {
+			skipped++
+		} else {
+			imported++
+		}
+	}
+	return imported, skipped, nil
+}
+
+// WriteIncidentExport writes the export of a single incident to the export directory,
+// and returns the path of the file.
+func WriteIncidentExport(db *sql.DB, c *bot.Configuration, inc *Incident, format string) (string, error) {
+	if c.ExportDirectory == "" {
+		return "", fmt.Errorf("The export directory is not configured")
+	}
+	e, err := inc.Export(db)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.ExportDirectory, 0755); err != nil {
+		return "", fmt.Errorf("Could not create the export directory: %v", err)
+	}
+	path := filepath.Join(c.ExportDirectory, fmt.Sprintf("incident-%d.%s", inc.ID, format))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("Could not write the export: %v", err)
+	}
+	defer f.Close()
+	if err := WriteExport(f, []*ExportedIncident{e}, format); err != nil {
+		return "", fmt.Errorf("Could not write the export: %v", err)
+	}
+	return path, nil
+}
+
+// IRC actions
+func exportIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	format := args[1]
+	if format == "" {
+		format = FormatJSON
+	}
+	path, err := WriteIncidentExport(db, c, inc, format)
+	if err != nil {
+		irc.Reply(m, fmt.Sprintf("Could not export incident %d: %s", inc.ID, err))
+		log.Error("Could not export the incident", "error", err, "incident", inc.ID)
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("Incident %d exported to %s", inc.ID, path))
+	return true
+}
@@ -0,0 +1,176 @@
+package incident
+
+import (
+	"blabber/bot"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	started := time.Date(2026, 3, 2, 10, 4, 0, 0, time.UTC)
+	updated := time.Date(2026, 3, 2, 11, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		incident ExportedIncident
+		// The timeline texts after the CSV round trip, tabs and newlines become spaces
+		texts []string
+	}{
+		{
+			name: "empty timeline",
+			incident: ExportedIncident{ID: 1, Severity: 3, Status: "investigating", Components: []string{"Website"},
+				Description: "Slow pages", StartedAt: started, UpdatedAt: updated, Timeline: []*ExportedEvent{}},
+			texts: []string{},
+		},
+		{
+			name: "tabs and newlines in the timeline",
+			incident: ExportedIncident{ID: 2, Severity: 1, Status: "resolved", Components: []string{"Website", "REST api"},
+				Description: "Everything, down", StartedAt: started, UpdatedAt: updated, DocumentID: "doc-2", Channel: "#incident-2",
+				Impact: Impact{Regions: []string{"eqiad", "codfw"}, Users: 15, ErrorRate: 2.5},
+				Timeline: []*ExportedEvent{
+					{Kind: EventStart, Author: "alice", CreatedAt: started, Text: ""},
+					{Kind: EventLog, Author: "bob", CreatedAt: started.Add(time.Minute), Text: "restarted\tthe app servers\nno change"},
+					{Kind: EventClose, Author: "alice", CreatedAt: updated, Text: "fixed, \"finally\""},
+				}},
+			texts: []string{"", "restarted the app servers no change", "fixed, \"finally\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteExport(&buf, []*ExportedIncident{&tt.incident}, FormatCSV); err != nil {
+				t.Fatalf("WriteExport: %v", err)
+			}
+			incidents, err := ReadExport(&buf, FormatCSV)
+			if err != nil {
+				t.Fatalf("ReadExport: %v", err)
+			}
+			if len(incidents) != 1 {
+				t.Fatalf("got %d incidents, want 1", len(incidents))
+			}
+			got := incidents[0]
+			want := tt.incident
+			if got.ID != want.ID || got.Severity != want.Severity || got.Status != want.Status ||
+				got.Description != want.Description || got.DocumentID != want.DocumentID || got.Channel != want.Channel {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+			if !reflect.DeepEqual(got.Components, want.Components) {
+				t.Errorf("got components %q, want %q", got.Components, want.Components)
+			}
+			if !got.StartedAt.Equal(want.StartedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+				t.Errorf("got times %s, %s, want %s, %s", got.StartedAt, got.UpdatedAt, want.StartedAt, want.UpdatedAt)
+			}
+			if !reflect.DeepEqual(got.Impact, want.Impact) {
+				t.Errorf("got impact %+v, want %+v", got.Impact, want.Impact)
+			}
+			if len(got.Timeline) != len(want.Timeline) {
+				t.Fatalf("got %d events, want %d", len(got.Timeline), len(want.Timeline))
+			}
+			for n, ev := range got.Timeline {
+				expected := want.Timeline[n]
+				if ev.Kind != expected.Kind || ev.Author != expected.Author || !ev.CreatedAt.Equal(expected.CreatedAt) || ev.Text != tt.texts[n] {
+					t.Errorf("event %d: got %+v, want %+v with text %q", n, ev, expected, tt.texts[n])
+				}
+			}
+		})
+	}
+}
+
+func TestExportRoundTripJSON(t *testing.T) {
+	started := time.Date(2026, 3, 2, 10, 4, 0, 0, time.UTC)
+	e := ExportedIncident{ID: 3, Severity: 2, Status: "monitoring", Components: []string{"Multimedia"},
+		Description: "Uploads failing", StartedAt: started, UpdatedAt: started,
+		Timeline: []*ExportedEvent{{Kind: EventLog, Author: "carol", CreatedAt: started, Text: "tabs\tand\nnewlines are kept"}}}
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, []*ExportedIncident{&e}, FormatJSON); err != nil {
+		t.Fatalf("WriteExport: %v", err)
+	}
+	incidents, err := ReadExport(&buf, FormatJSON)
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+	if len(incidents) != 1 || !reflect.DeepEqual(*incidents[0], e) {
+		t.Errorf("got %+v, want %+v", incidents, e)
+	}
+}
+
+func TestReadExportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+	}{
+		{"unknown format", "", "xml"},
+		{"missing columns", "id,severity\n1,2\n", FormatCSV},
+		{"invalid severity", "id,severity,status,components,description,started_at,updated_at,document_id,channel,impact,timeline\n" +
+			"1,high,investigating,Website,,2026-03-02T10:04:00Z,2026-03-02T10:04:00Z,,,,\n", FormatCSV},
+		{"invalid timeline", "id,severity,status,components,description,started_at,updated_at,document_id,channel,impact,timeline\n" +
+			"1,2,investigating,Website,,2026-03-02T10:04:00Z,2026-03-02T10:04:00Z,,,,not an event\n", FormatCSV},
+		{"invalid JSON", "{", FormatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadExport(bytes.NewBufferString(tt.input), tt.format); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestImportIncidents(t *testing.T) {
+	db := newTestDB(t)
+	c := &bot.Configuration{Components: []bot.ComponentConfig{{Name: "Website", Aliases: []string{"www"}}}}
+	started := time.Date(2026, 3, 2, 10, 4, 0, 0, time.UTC)
+	incidents := []*ExportedIncident{
+		{ID: 12, Severity: 2, Status: "resolved", Components: []string{"www"}, StartedAt: started, Description: "Outage",
+			Timeline: []*ExportedEvent{{Kind: EventStart, Author: "alice", CreatedAt: started, Text: "severity 2"}}},
+		{ID: 13, Severity: 3, Status: "resolved", Components: []string{"Legacy"}, StartedAt: started.Add(time.Hour)},
+		// Another tracker may reuse the same ids.
+		{ID: 12, Severity: 4, Status: "resolved", Components: []string{"Legacy"}, StartedAt: started.Add(48 * time.Hour)},
+		// Incidents without an id are always imported.
+		{Severity: 4, Status: "resolved", Components: []string{"Legacy"}, StartedAt: started},
+	}
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	imported, skipped, err := ImportIncidents(db, c, incidents)
+	if err != nil || imported != 4 || skipped != 0 {
+		t.Fatalf("got %d imported, %d skipped, error %v, want 4 imported", imported, skipped, err)
+	}
+	inc, err := GetByID(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inc.Components(), []string{"Website"}) {
+		t.Errorf("got components %v, want the normalized ones", inc.Components())
+	}
+	// Importing the file again only imports the incidents without an id.
+	imported, skipped, err = ImportIncidents(db, c, incidents)
+	if err != nil || imported != 1 || skipped != 3 {
+		t.Fatalf("got %d imported, %d skipped, error %v, want 1 imported, 3 skipped", imported, skipped, err)
+	}
+	if n := count("incidents"); n != 5 {
+		t.Errorf("got %d incidents, want 5", n)
+	}
+	if n := count("incident_events"); n != 1 {
+		t.Errorf("got %d events, want 1", n)
+	}
+	// The import stops at the first error.
+	invalid := []*ExportedIncident{
+		{ID: 20, Severity: 2, Status: "resolved", Components: []string{"www"}, StartedAt: started},
+		{ID: 21, Severity: 7, Status: "resolved", Components: []string{"www"}, StartedAt: started},
+	}
+	imported, _, err = ImportIncidents(db, c, invalid)
+	if err == nil || imported != 1 {
+		t.Fatalf("got %d imported, error %v, want 1 imported and an error", imported, err)
+	}
+	if n := count("incidents"); n != 6 {
+		t.Errorf("got %d incidents, want 6", n)
+	}
+}
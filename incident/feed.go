@@ -0,0 +1,147 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// feedSize is the number of incidents listed in the feed.
+const feedSize = 20
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string    `xml:"title"`
+	ID        string    `xml:"id"`
+	Link      *atomLink `xml:"link,omitempty"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+	Summary   string    `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Link    *atomLink    `xml:"link,omitempty"`
+	Updated string       `xml:"updated"`
+	Author  string       `xml:"author>name"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+// newFeed builds the Atom feed of the recently updated incidents. Like on the status
+// page, only public components are shown, and links to the documents are never included.
+func newFeed(db *sql.DB, c *bot.Configuration) (*atomFeed, error) {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		return nil, err
+	}
+	public := make(map[string]bool)
+	for _, comp := range components {
+		public[comp.Name] = comp.Public
+	}
+	incidents, err := getRecentIncidents(db, feedSize, false)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(c.HTTPBaseURL, "/")
+	feed := atomFeed{
+		Title:   c.StatusPageTitle,
+		ID:      feedID(base, "incidents"),
+		Updated: time.Now().Format(time.RFC3339),
+		Author:  c.NickName,
+	}
+	if base != "" {
+		feed.Link = &atomLink{Href: base + "/incidents.atom", Rel: "self"}
+	}
+	for _, inc := range incidents {
+		var names []string
+		for _, name := range inc.components {
+			if public[name] {
+				names = append(names, name)
+			}
+		}
+		if names == nil {
+			continue
+		}
+		entry := atomEntry{
+			Title:     fmt.Sprintf("Incident #%d (%s): %s", inc.ID, StatusName(inc.Status), strings.Join(names, ", ")),
+			ID:        feedID(base, fmt.Sprintf("incident/%d", inc.ID)),
+			Published: inc.startedAt.Format(time.RFC3339),
+			Updated:   inc.updatedAt.Format(time.RFC3339),
+			Summary: fmt.Sprintf("Severity %d incident affecting %s, started at %s. Current status: %s.",
+				inc.severity, strings.Join(names, ", "), inc.startedAt.Format("2006-01-02 15:04 MST"), StatusName(inc.Status)),
+		}
+		if base != "" {
+			entry.Link = &atomLink{Href: base + "/"}
+		}
+		feed.Entries = append(feed.Entries, &entry)
+	}
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	}
+	return &feed, nil
+}
+
+// feedID returns a unique id for an element of the feed.
+func feedID(base string, path string) string {
+	if base != "" {
+		return base + "/" + path
+	}
+	return "urn:blabber:" + strings.Replace(path, "/", ":", -1)
+}
+
+// incidentsFeed serves the Atom feed, caching it for a short time.
+type incidentsFeed struct {
+	db      *sql.DB
+	config  *bot.Configuration
+	lock    sync.Mutex
+	feed    *atomFeed
+	builtAt time.Time
+}
+
+func (f *incidentsFeed) get() (*atomFeed, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.feed == nil || time.Since(f.builtAt) > statusPageTTL {
+		feed, err := newFeed(f.db, f.config)
+		if err != nil {
+			return nil, err
+		}
+		f.feed = feed
+		f.builtAt = time.Now()
+	}
+	return f.feed, nil
+}
+
+func (f *incidentsFeed) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	feed, err := f.get()
+	if err != nil {
+		log.Error("Could not build the incidents feed", "error", err)
+		http.Error(w, "Could not build the incidents feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Error("Could not encode the incidents feed", "error", err)
+	}
+}
+
+// RegisterFeed adds the Atom feed of the recent incidents to the HTTP server.
+func RegisterFeed(server *web.Server, db *sql.DB, c *bot.Configuration) {
+	f := &incidentsFeed{db: db, config: c}
+	server.Handle("/incidents.atom", http.HandlerFunc(f.serveHTTP))
+}
@@ -4,24 +4,15 @@ import (
 	"blabber/bot"
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
 
+	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
 	log "gopkg.in/inconshreveable/log15.v2"
 )
 
-// RemoteDocument is a simple interface for
-// Interacting with different type of documents
-type RemoteDocument interface {
-	// Gets the remote document from a template
-	NewFromTemplate(title string, c *bot.Configuration) error
-	// Gets the remote document from its ID
-	GetFromId(documentID string) error
-	// Returns the url at which you can fetch the document.
-	Url() string
-	// Returns the unique ID that can be used for GetFromId later
-	Id() string
-}
-
 // GoogleDoc is a RemoteDocument implementation that uses Google Docs.
 type GoogleDoc struct {
 	Config  *GoogleDriveConfig
@@ -61,15 +52,71 @@ func (doc *GoogleDoc) NewFromTemplate(title string, c *bot.Configuration) error
 	if err != nil {
 		return fmt.Errorf("Could not copy the template to a new file: %v", err)
 	}
-	// Set the correct permissions on the new file.
-	permissions := drive.NewPermissionsService(doc.Service)
-	if _, err = permissions.Create(gFile.Id, &drive.Permission{Domain: "wikimedia.org", AllowFileDiscovery: true, Type: "domain", Role: "writer"}).SupportsTeamDrives(true).Context(context.TODO()).Do(); err != nil {
-		return fmt.Errorf("Error adding permissions to the document: %v", err)
+	doc.file = gFile
+	return doc.share(c)
+}
+
+// NewFromText creates a new google doc from plain text.
+func (doc *GoogleDoc) NewFromText(title string, content string, c *bot.Configuration) error {
+	files := drive.NewFilesService(doc.Service)
+	// Uploading text with the google docs mime type converts it to a google doc.
+	file := &drive.File{Name: title, Parents: []string{c.DocFolder}, TeamDriveId: c.DocDrive, MimeType: "application/vnd.google-apps.document"}
+	gFile, err := files.Create(file).Media(strings.NewReader(content)).SupportsTeamDrives(true).Context(context.TODO()).Do()
+	if err != nil {
+		return fmt.Errorf("Could not create a new file: %v", err)
 	}
 	doc.file = gFile
+	return doc.share(c)
+}
+
+// share sets the correct permissions on the file.
+func (doc *GoogleDoc) share(c *bot.Configuration) error {
+	perms, err := sharingPermissions(c.DocSharing)
+	if err != nil {
+		return err
+	}
+	permissions := drive.NewPermissionsService(doc.Service)
+	for _, perm := range perms {
+		call := permissions.Create(doc.file.Id, perm).SupportsTeamDrives(true)
+		if perm.Type != "domain" {
+			call = call.SendNotificationEmail(false)
+		}
+		if _, err = call.Context(context.TODO()).Do(); err != nil {
+			return fmt.Errorf("Error adding permissions to the document: %v", err)
+		}
+	}
 	return nil
 }
 
+// sharingPermissions translates the sharing policy into the permissions to add to a new document.
+func sharingPermissions(s bot.DocSharing) ([]*drive.Permission, error) {
+	role := s.Role
+	switch role {
+	case "":
+		role = "writer"
+	case "reader", "commenter", "writer":
+	default:
+		return nil, fmt.Errorf("Invalid role for document sharing: '%s'", role)
+	}
+	var perms []*drive.Permission
+	if s.Domain != "" {
+		perms = append(perms, &drive.Permission{Domain: s.Domain, AllowFileDiscovery: s.Discoverable, Type: "domain", Role: role})
+	}
+	for _, group := range s.Groups {
+		if !strings.Contains(group, "@") {
+			return nil, fmt.Errorf("Invalid group for document sharing: '%s'", group)
+		}
+		perms = append(perms, &drive.Permission{EmailAddress: group, Type: "group", Role: role})
+	}
+	for _, user := range s.Users {
+		if !strings.Contains(user, "@") {
+			return nil, fmt.Errorf("Invalid user for document sharing: '%s'", user)
+		}
+		perms = append(perms, &drive.Permission{EmailAddress: user, Type: "user", Role: role})
+	}
+	return perms, nil
+}
+
 // GetFromId  fetches the file by ID.
 func (doc *GoogleDoc) GetFromId(documentID string) error {
 	files := drive.NewFilesService(doc.Service)
@@ -81,6 +128,17 @@ func (doc *GoogleDoc) GetFromId(documentID string) error {
 	return nil
 }
 
+// Replace uploads new content for the file, which is converted to a google doc again.
+func (doc *GoogleDoc) Replace(content string) error {
+	files := drive.NewFilesService(doc.Service)
+	gFile, err := files.Update(doc.Id(), &drive.File{}).Media(strings.NewReader(content)).SupportsTeamDrives(true).Context(context.TODO()).Do()
+	if err != nil {
+		return fmt.Errorf("Could not update the document with id %s: %v", doc.Id(), err)
+	}
+	doc.file = gFile
+	return nil
+}
+
 // Url returns the url you can reach your document at.
 func (doc *GoogleDoc) Url() string {
 	if doc.file == nil || doc.file.Id == "" {
@@ -93,3 +151,106 @@ func (doc *GoogleDoc) Url() string {
 func (doc *GoogleDoc) Id() string {
 	return doc.file.Id
 }
+
+// Append adds a line of text at the end of the "Timeline" section of the document,
+// or at the end of the document if no such section exists.
+func (doc *GoogleDoc) Append(text string) error {
+	client, err := doc.Config.GetClient()
+	if err != nil {
+		return fmt.Errorf("Could not initiate the connection to the google docs API: %v", err)
+	}
+	service, err := docs.New(client)
+	if err != nil {
+		return fmt.Errorf("Could not connect to the docs service: %v", err)
+	}
+	document, err := service.Documents.Get(doc.Id()).Context(context.TODO()).Do()
+	if err != nil {
+		return fmt.Errorf("Could not fetch the document with id %s: %v", doc.Id(), err)
+	}
+	var requests []*docs.Request
+	index, isHeading := timelineEnd(document)
+	if index == 0 {
+		requests = append(requests, &docs.Request{InsertText: &docs.InsertTextRequest{
+			Text:                 text + "\n",
+			EndOfSegmentLocation: &docs.EndOfSegmentLocation{},
+		}})
+	} else {
+		// Insert a new paragraph right after the last one of the section.
+		requests = append(requests, &docs.Request{InsertText: &docs.InsertTextRequest{
+			Text:     "\n" + text,
+			Location: &docs.Location{Index: index},
+		}})
+		// The new paragraph inherits the style of the previous one, which could be the heading.
+		if isHeading {
+			requests = append(requests, &docs.Request{UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+				Range:          &docs.Range{StartIndex: index + 1, EndIndex: index + 1 + int64(len(utf16.Encode([]rune(text))))},
+				ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: "NORMAL_TEXT"},
+				Fields:         "namedStyleType",
+			}})
+		}
+	}
+	update := &docs.BatchUpdateDocumentRequest{Requests: requests}
+	if _, err = service.Documents.BatchUpdate(doc.Id(), update).Context(context.TODO()).Do(); err != nil {
+		return fmt.Errorf("Could not update the document with id %s: %v", doc.Id(), err)
+	}
+	return nil
+}
+
+// timelineEnd finds the index right before the newline ending the last paragraph
+// of the "Timeline" section, and if such paragraph is the section heading.
+// It returns 0 if the document has no such section.
+func timelineEnd(document *docs.Document) (int64, bool) {
+	if document.Body == nil {
+		return 0, false
+	}
+	var index int64
+	var sectionLevel int
+	var isHeading bool
+	for _, element := range document.Body.Content {
+		if element.Paragraph == nil {
+			continue
+		}
+		level := headingLevel(element.Paragraph)
+		if sectionLevel != 0 {
+			if level != 0 && level <= sectionLevel {
+				// We reached the next section
+				break
+			}
+			index = element.EndIndex - 1
+			isHeading = false
+		} else if level != 0 && strings.EqualFold(paragraphText(element.Paragraph), "timeline") {
+			sectionLevel = level
+			index = element.EndIndex - 1
+			isHeading = true
+		}
+	}
+	return index, isHeading
+}
+
+// headingLevel returns the level of a heading paragraph (1 for the title), or 0
+// if the paragraph is not a heading.
+func headingLevel(p *docs.Paragraph) int {
+	if p.ParagraphStyle == nil {
+		return 0
+	}
+	style := p.ParagraphStyle.NamedStyleType
+	if style == "TITLE" {
+		return 1
+	}
+	if strings.HasPrefix(style, "HEADING_") {
+		if level, err := strconv.Atoi(strings.TrimPrefix(style, "HEADING_")); err == nil {
+			return level + 1
+		}
+	}
+	return 0
+}
+
+func paragraphText(p *docs.Paragraph) string {
+	var text string
+	for _, element := range p.Elements {
+		if element.TextRun != nil {
+			text += element.TextRun.Content
+		}
+	}
+	return strings.TrimSpace(text)
+}
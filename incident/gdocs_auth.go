@@ -2,28 +2,70 @@
 package incident
 
 import (
+	"blabber/bot"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
 )
 
+// scopes we need to manage the incident documents.
+// We use DriveScope (the widest possible) because more contained scopes didn't allow to copy
+// new docs easily. It's possible that DriveFileScope is enough though.
+// DocumentsScope is needed to add updates to the documents.
+var scopes = []string{drive.DriveScope, docs.DocumentsScope}
+
+// deviceScopes are the scopes requested with the device flow, which rejects the ones above
+// with invalid_scope. With DriveFileScope, blabber can only access the files it created itself.
+var deviceScopes = []string{drive.DriveFileScope}
+
+// deviceCodeURL is the endpoint to start the OAuth2 device flow with google.
+const deviceCodeURL = "https://oauth2.googleapis.com/device/code"
+
 type GoogleDriveConfig struct {
 	CredentialsFileName string
 	TokenFileName       string
-	config              *oauth2.Config
+	// JSON key of a service account. If set, it's used instead of OAuth2 tokens.
+	ServiceAccountFileName string
+	// User to impersonate with the service account, if domain-wide delegation is enabled.
+	Subject string
+	config  *oauth2.Config
 }
 
 // GDriveConfig is a global var to keep the google drive configuration
 // yuck!
 var GDriveConfig = &GoogleDriveConfig{}
 
+// CheckDeviceFlow tells if the device flow can be used with the configuration: with
+// deviceScopes, the templates and the folder configured for the documents can't be read.
+func CheckDeviceFlow(c *bot.Configuration) error {
+	if c.DocBackend != BackendGoogleDocs {
+		return nil
+	}
+	if c.DocTemplate != "" {
+		return fmt.Errorf("The device flow cannot read the document template %s, use the browser flow or a service account", c.DocTemplate)
+	}
+	for _, t := range c.IncidentTemplates {
+		if t.DocTemplate != "" {
+			return fmt.Errorf("The device flow cannot read the document template %s of the %s incidents, use the browser flow or a service account", t.DocTemplate, t.Name)
+		}
+	}
+	if c.DocFolder != "" {
+		return fmt.Errorf("The device flow cannot create documents in the folder %s, use the browser flow or a service account", c.DocFolder)
+	}
+	return nil
+}
+
 // GetConfigs returns the oauth2 configuration
 func (g *GoogleDriveConfig) GetConfig() (*oauth2.Config, error) {
 	if g.config == nil {
@@ -31,9 +73,7 @@ func (g *GoogleDriveConfig) GetConfig() (*oauth2.Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Could not read the credentials file: %v", err)
 		}
-		// We use DriveScope (the widest possible) because more contained scopes didn't allow to copy
-		// new docs easily. It's possible that DriveFileScope is enough though.
-		config, err := google.ConfigFromJSON(data, drive.DriveScope)
+		config, err := google.ConfigFromJSON(data, scopes...)
 		if err != nil {
 			return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
 		}
@@ -42,7 +82,8 @@ func (g *GoogleDriveConfig) GetConfig() (*oauth2.Config, error) {
 	return g.config, nil
 }
 
-// GetToken gets a token (either from file if present or via OAUTH2)
+// GetToken gets the token saved to file. It never asks for authorization,
+// as blabber might not be running interactively: use Authorize for that.
 func (g *GoogleDriveConfig) GetToken() (*oauth2.Token, error) {
 	_, err := g.GetConfig()
 	if err != nil {
@@ -50,16 +91,36 @@ func (g *GoogleDriveConfig) GetToken() (*oauth2.Token, error) {
 	}
 	tok, err := g.getTokenFromFile()
 	if err != nil {
+		return nil, fmt.Errorf("No valid OAuth2 token found, please run 'blabber auth': %v", err)
+	}
+	return tok, nil
+}
+
+// Authorize obtains a new OAuth2 token interactively, and saves it to file.
+// The user will need to paste the authorization code obtained from the browser, unless
+// useDevice is true: the device flow is used then, with the restricted deviceScopes.
+func (g *GoogleDriveConfig) Authorize(useDevice bool) error {
+	_, err := g.GetConfig()
+	if err != nil {
+		return err
+	}
+	var tok *oauth2.Token
+	if useDevice {
+		tok, err = g.getTokenFromDevice()
+	} else {
 		tok, err = g.getTokenFromWeb()
-		if err == nil {
-			err = g.saveTokenToFile(tok)
-		}
 	}
-	return tok, err
+	if err != nil {
+		return err
+	}
+	return g.saveTokenToFile(tok)
 }
 
 // GetClient returns an http client that can be used interacting with the GDocs API
 func (g *GoogleDriveConfig) GetClient() (*http.Client, error) {
+	if g.ServiceAccountFileName != "" {
+		return g.getServiceAccountClient()
+	}
 	tok, err := g.GetToken()
 	if err != nil {
 		return nil, err
@@ -67,6 +128,19 @@ func (g *GoogleDriveConfig) GetClient() (*http.Client, error) {
 	return g.config.Client(context.Background(), tok), nil
 }
 
+func (g *GoogleDriveConfig) getServiceAccountClient() (*http.Client, error) {
+	data, err := ioutil.ReadFile(g.ServiceAccountFileName)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the service account key: %v", err)
+	}
+	config, err := google.JWTConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the service account key: %v", err)
+	}
+	config.Subject = g.Subject
+	return config.Client(context.Background()), nil
+}
+
 func (g *GoogleDriveConfig) getTokenFromFile() (*oauth2.Token, error) {
 	f, err := os.Open(g.TokenFileName)
 	if err != nil {
@@ -95,6 +169,96 @@ func (g *GoogleDriveConfig) getTokenFromWeb() (*oauth2.Token, error) {
 	return tok, err
 }
 
+// deviceCode is the response of the device code endpoint.
+type deviceCode struct {
+	DeviceCode       string `json:"device_code"`
+	UserCode         string `json:"user_code"`
+	VerificationURL  string `json:"verification_url"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Interval         int64  `json:"interval"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// tokenResponse is the response of the token endpoint during the device flow.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauthError formats an error returned by the OAuth2 server.
+func oauthError(code string, description string) string {
+	if description == "" {
+		return code
+	}
+	return fmt.Sprintf("%s (%s)", code, description)
+}
+
+func postForm(endpoint string, values url.Values, result interface{}) error {
+	resp, err := http.PostForm(endpoint, values)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (g *GoogleDriveConfig) getTokenFromDevice() (*oauth2.Token, error) {
+	var code deviceCode
+	values := url.Values{"client_id": {g.config.ClientID}, "scope": {strings.Join(deviceScopes, " ")}}
+	if err := postForm(deviceCodeURL, values, &code); err != nil {
+		return nil, fmt.Errorf("Unable to start the device authorization: %v", err)
+	}
+	if code.Error != "" {
+		return nil, fmt.Errorf("Unable to start the device authorization: %s", oauthError(code.Error, code.ErrorDescription))
+	}
+	if code.DeviceCode == "" {
+		return nil, fmt.Errorf("Unable to start the device authorization, check your credentials")
+	}
+	fmt.Println("#### OAUTH2 AUTORIZATION FOR GOOGLE DOCS ####")
+	fmt.Printf("Please go to %s and enter the code %s\n", code.VerificationURL, code.UserCode)
+	interval := time.Duration(code.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	values = url.Values{
+		"client_id":     {g.config.ClientID},
+		"client_secret": {g.config.ClientSecret},
+		"device_code":   {code.DeviceCode},
+		"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		var resp tokenResponse
+		if err := postForm(g.config.Endpoint.TokenURL, values, &resp); err != nil {
+			return nil, fmt.Errorf("Unable to retrieve token: %v", err)
+		}
+		switch resp.Error {
+		case "":
+			tok := &oauth2.Token{
+				AccessToken:  resp.AccessToken,
+				TokenType:    resp.TokenType,
+				RefreshToken: resp.RefreshToken,
+			}
+			if resp.ExpiresIn > 0 {
+				tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+			}
+			return tok, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, fmt.Errorf("Unable to retrieve token: %s", oauthError(resp.Error, resp.ErrorDescription))
+		}
+	}
+	return nil, fmt.Errorf("The device code expired before authorization was granted")
+}
+
 // Save a token to file.
 func (g *GoogleDriveConfig) saveTokenToFile(token *oauth2.Token) error {
 	f, err := os.OpenFile(g.TokenFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
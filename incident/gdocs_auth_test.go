@@ -0,0 +1,33 @@
+package incident
+
+import (
+	"blabber/bot"
+	"testing"
+)
+
+func TestCheckDeviceFlow(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  bot.Configuration
+		valid bool
+	}{
+		{"no template", bot.Configuration{DocBackend: BackendGoogleDocs}, true},
+		{"template", bot.Configuration{DocBackend: BackendGoogleDocs, DocTemplate: "1AbCdEf"}, false},
+		{"incident template", bot.Configuration{
+			DocBackend:        BackendGoogleDocs,
+			IncidentTemplates: []bot.IncidentTemplateConfig{{Name: "db"}, {Name: "security", DocTemplate: "2GhIjKl"}},
+		}, false},
+		{"incident template without document", bot.Configuration{
+			DocBackend:        BackendGoogleDocs,
+			IncidentTemplates: []bot.IncidentTemplateConfig{{Name: "db"}},
+		}, true},
+		{"folder", bot.Configuration{DocBackend: BackendGoogleDocs, DocFolder: "3MnOpQr"}, false},
+		{"markdown template", bot.Configuration{DocBackend: BackendMarkdown, DocTemplate: "template.md"}, true},
+	}
+	for _, test := range tests {
+		err := CheckDeviceFlow(&test.conf)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
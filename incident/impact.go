@@ -0,0 +1,164 @@
+package incident
+
+import (
+	"blabber/bot"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Impact describes how an incident affects the users, beyond its severity and components.
+// Zero values mean that the figure is unknown.
+type Impact struct {
+	// Datacenters or regions affected
+	Regions []string `json:"regions,omitempty"`
+	// Estimated percentage of the users affected
+	Users float64 `json:"users,omitempty"`
+	// Percentage of the requests failing
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// Percentage of the SLO error budget consumed
+	SLOBudget float64 `json:"slo_budget,omitempty"`
+}
+
+// IsEmpty tells you if nothing is known about the impact.
+func (im Impact) IsEmpty() bool {
+	return len(im.Regions) == 0 && im.Users == 0 && im.ErrorRate == 0 && im.SLOBudget == 0
+}
+
+// String formats the impact for humans.
+func (im Impact) String() string {
+	var parts []string
+	if len(im.Regions) > 0 {
+		parts = append(parts, "regions "+strings.Join(im.Regions, ", "))
+	}
+	if im.Users != 0 {
+		parts = append(parts, fmt.Sprintf("%s%% of users", formatFigure(im.Users)))
+	}
+	if im.ErrorRate != 0 {
+		parts = append(parts, fmt.Sprintf("%s%% errors", formatFigure(im.ErrorRate)))
+	}
+	if im.SLOBudget != 0 {
+		parts = append(parts, fmt.Sprintf("%s%% of the SLO budget", formatFigure(im.SLOBudget)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Args formats the impact in the format understood by ParseImpact.
+func (im Impact) Args() string {
+	var parts []string
+	if len(im.Regions) > 0 {
+		parts = append(parts, "regions="+strings.Join(im.Regions, ","))
+	}
+	if im.Users != 0 {
+		parts = append(parts, "users="+formatFigure(im.Users))
+	}
+	if im.ErrorRate != 0 {
+		parts = append(parts, "errors="+formatFigure(im.ErrorRate))
+	}
+	if im.SLOBudget != 0 {
+		parts = append(parts, "slo="+formatFigure(im.SLOBudget))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFigure(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// parsePercentage parses a percentage, with or without the % sign.
+func parsePercentage(key string, value string, max float64) (float64, error) {
+	figure, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || figure < 0 || (max > 0 && figure > max) {
+		if max > 0 {
+			return 0, fmt.Errorf("The value of %s must be a percentage between 0 and %s", key, formatFigure(max))
+		}
+		return 0, fmt.Errorf("The value of %s must be a positive percentage", key)
+	}
+	return figure, nil
+}
+
+// ParseImpact applies a list of key=value pairs, e.g. "regions=eqiad,codfw users=15 errors=2.5% slo=40",
+// to the current impact of an incident. Figures not given are left untouched, and setting them to 0 clears them.
+// If regions are listed in the configuration, only those are accepted.
+func ParseImpact(value string, current Impact, c *bot.Configuration) (Impact, error) {
+	impact := current
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return impact, fmt.Errorf("Please give the impact as key=value pairs, e.g. regions=eqiad,codfw users=15 errors=2.5 slo=40")
+	}
+	splitRegex := regexp.MustCompile(",\\s*")
+	for _, field := range fields {
+		pair := strings.SplitN(field, "=", 2)
+		if len(pair) != 2 {
+			return current, fmt.Errorf("Could not parse '%s', expected key=value", field)
+		}
+		var err error
+		switch pair[0] {
+		case "regions":
+			impact.Regions = nil
+			for _, region := range splitRegex.Split(pair[1], -1) {
+				if region == "" {
+					continue
+				}
+				if !isKnownRegion(region, c) {
+					return current, fmt.Errorf("Unknown region '%s', known regions are: %s", region, strings.Join(c.Regions, ", "))
+				}
+				impact.Regions = append(impact.Regions, region)
+			}
+		case "users":
+			impact.Users, err = parsePercentage(pair[0], pair[1], 100)
+		case "errors":
+			impact.ErrorRate, err = parsePercentage(pair[0], pair[1], 100)
+		case "slo":
+			// The budget can be overspent.
+			impact.SLOBudget, err = parsePercentage(pair[0], pair[1], 0)
+		default:
+			return current, fmt.Errorf("Unknown impact '%s', use regions, users, errors or slo", pair[0])
+		}
+		if err != nil {
+			return current, err
+		}
+	}
+	return impact, nil
+}
+
+func isKnownRegion(region string, c *bot.Configuration) bool {
+	if len(c.Regions) == 0 {
+		return true
+	}
+	for _, known := range c.Regions {
+		if known == region {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeImpact serializes the impact for the database.
+func encodeImpact(im Impact) (string, error) {
+	if im.IsEmpty() {
+		return "", nil
+	}
+	data, err := json.Marshal(im)
+	return string(data), err
+}
+
+// decodeImpact parses an impact serialized with encodeImpact.
+func decodeImpact(value string) (Impact, error) {
+	var im Impact
+	if value == "" {
+		return im, nil
+	}
+	err := json.Unmarshal([]byte(value), &im)
+	return im, err
+}
+
+// SetImpact changes the impact of the incident, recording the change in the timeline.
+func (i *Incident) SetImpact(impact Impact, author string) {
+	i.Impact = impact
+	i.updatedAt = time.Now()
+	i.AddEvent(EventImpact, author, impact.String())
+}
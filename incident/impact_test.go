@@ -0,0 +1,51 @@
+package incident
+
+import (
+	"blabber/bot"
+	"reflect"
+	"testing"
+)
+
+func TestParseImpact(t *testing.T) {
+	regions := &bot.Configuration{Regions: []string{"eqiad", "codfw", "esams"}}
+	current := Impact{Regions: []string{"esams"}, Users: 10}
+	tests := []struct {
+		name    string
+		value   string
+		current Impact
+		conf    *bot.Configuration
+		want    Impact
+		valid   bool
+	}{
+		{"all figures", "regions=eqiad,codfw users=15 errors=2.5% slo=40", Impact{}, regions,
+			Impact{Regions: []string{"eqiad", "codfw"}, Users: 15, ErrorRate: 2.5, SLOBudget: 40}, true},
+		{"figures not given are kept", "errors=1", current, regions,
+			Impact{Regions: []string{"esams"}, Users: 10, ErrorRate: 1}, true},
+		{"regions are replaced", "regions=eqiad", current, regions,
+			Impact{Regions: []string{"eqiad"}, Users: 10}, true},
+		{"zero clears a figure", "users=0", current, regions, Impact{Regions: []string{"esams"}}, true},
+		{"the SLO budget can be overspent", "slo=250%", Impact{}, regions, Impact{SLOBudget: 250}, true},
+		{"any region without a list", "regions=ulsfo", Impact{}, &bot.Configuration{}, Impact{Regions: []string{"ulsfo"}}, true},
+		{"unknown region", "regions=eqiad,ulsfo", current, regions, current, false},
+		{"more than 100% of users", "users=101", current, regions, current, false},
+		{"negative error rate", "errors=-1", current, regions, current, false},
+		{"not a number", "users=many", current, regions, current, false},
+		{"unknown key", "latency=200", current, regions, current, false},
+		{"missing value", "users", current, regions, current, false},
+		{"empty", "", current, regions, current, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImpact(tt.value, tt.current, tt.conf)
+			if tt.valid && err != nil {
+				t.Fatalf("ParseImpact(%q) failed: %v", tt.value, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("ParseImpact(%q) = %+v, want an error", tt.value, got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImpact(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,35 +2,49 @@ package incident
 
 import (
 	"blabber/bot"
+	"blabber/webhook"
 	"database/sql"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	hbot "github.com/whyrusleeping/hellabot"
 	log "gopkg.in/inconshreveable/log15.v2"
 )
 
-// PublicComponents are a list of things that can break
-// from the public POV
-var PublicComponents = []string{
-	"Website",
-	"Mobile apps",
-	"Action API",
-	"REST api",
-	"Multimedia",
-	"Thumbnails",
-	"Other",
-}
-
-// Status of the incident.
-const (
-	StatusOpen int64 = iota
-	StatusClosed
-)
+// Querier is implemented by both *sql.DB and *sql.Tx, so that incidents can be saved in a transaction.
+type Querier interface {
+	Prepare(query string) (*sql.Stmt, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// updates serializes the changes to incidents. IRC commands, background jobs and HTTP handlers
+// all run in their own goroutines: an incident must be read, changed and saved with the lock
+// held, so that a stale copy never overwrites a concurrent change.
+var updates sync.Mutex
+
+// LockIncidents must be called before reading an incident to change it outside of the IRC commands.
+func LockIncidents() {
+	updates.Lock()
+}
+
+// UnlockIncidents must be called once the changes are saved.
+func UnlockIncidents() {
+	updates.Unlock()
+}
+
+// serialized runs an IRC command with the incidents locked.
+func serialized(action func([]string, *hbot.Bot, *hbot.Message, *bot.Configuration, *sql.DB) bool) func([]string, *hbot.Bot, *hbot.Message, *bot.Configuration, *sql.DB) bool {
+	return func(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+		LockIncidents()
+		defer UnlockIncidents()
+		return action(args, irc, m, c, db)
+	}
+}
 
 // The Incident struct is used to contain data about an incident.
 // Such data can be used to perform various actions like updating
@@ -44,40 +58,50 @@ type Incident struct {
 	Status      int64
 	ID          int64
 	Document    RemoteDocument
+	// ID of the document, kept even if the document could not be fetched
+	documentID string
+	// Dedicated IRC channel, if any
+	Channel string
+	// Impact on the users, beyond severity and components
+	Impact Impact
+	// Events added to the timeline but not yet saved.
+	pendingEvents []*Event
+	// Set until a new incident is published, even if it was saved before.
+	unpublished bool
 }
 
-// NewIncident creates an Incident object, and returns it
-func NewIncident(severity int64, components []string, c *bot.Configuration) (*Incident, error) {
+// NewIncident creates an Incident object, and returns it.
+// Components must be in the component catalog.
+func NewIncident(severity int64, components []string, c *bot.Configuration, db *sql.DB) (*Incident, error) {
 	if severity > 5 || severity < 1 {
 		return nil, errors.New("Severity must be between 1 and 5")
 	}
 	var normalized []string
+	seen := make(map[string]bool)
 	for _, component := range components {
-		c := strings.ToLower(component)
-		var found string
-		for _, comp := range PublicComponents {
-			if c == strings.ToLower(comp) {
-				found = comp
-			}
+		comp, err := LookupComponent(db, c, component)
+		if err != nil {
+			return nil, err
 		}
-		if found != "" {
-			normalized = append(normalized, found)
-		} else {
-			return nil, fmt.Errorf("Unknown component '%s'", component)
+		// Several aliases of the same component may be given.
+		if !seen[comp.Name] {
+			seen[comp.Name] = true
+			normalized = append(normalized, comp.Name)
 		}
 	}
 	inc := Incident{
-		severity:   severity,
-		components: normalized,
-		startedAt:  time.Now(),
-		updatedAt:  time.Now(),
-		Status:     StatusOpen,
+		severity:    severity,
+		components:  normalized,
+		startedAt:   time.Now(),
+		updatedAt:   time.Now(),
+		Status:      StatusOpen,
+		unpublished: true,
 	}
 	// Try to create the remote document.
-	document := NewGoogleDoc()
+	document := NewDocument()
 	if document != nil {
 		date := time.Now().Format("2006-01-02")
-		title := fmt.Sprintf("%s - %s", date, strings.Join(components, ", "))
+		title := fmt.Sprintf("%s - %s", date, strings.Join(normalized, ", "))
 		if err := document.NewFromTemplate(title, c); err != nil {
 			log.Error("Error saving the document", "error", err)
 		} else {
@@ -88,12 +112,12 @@ func NewIncident(severity int64, components []string, c *bot.Configuration) (*In
 }
 
 // Save allows to persist an incident to the database.
-func (i *Incident) Save(db *sql.DB) error {
+func (i *Incident) Save(db Querier) error {
 	var query string
 	if i.ID == 0 {
-		query = "INSERT INTO incidents (severity, components, started_at, updated_at, status, description, document_id) VALUES (?, ?, ?, ?, ?, ?, ?)"
+		query = "INSERT INTO incidents (severity, components, started_at, updated_at, status, description, document_id, channel, impact) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	} else {
-		query = "UPDATE incidents SET severity=?, components=?, updated_at=?, status=?, description=?, document_id=? WHERE id = ?"
+		query = "UPDATE incidents SET severity=?, components=?, updated_at=?, status=?, description=?, document_id=?, channel=?, impact=? WHERE id = ?"
 	}
 	statement, err := db.Prepare(query)
 	if err != nil {
@@ -102,28 +126,98 @@ func (i *Incident) Save(db *sql.DB) error {
 	started := i.startedAt.Format(time.RFC3339)
 	updated := i.updatedAt.Format(time.RFC3339)
 	components := strings.Join(i.components, ", ")
-	var documentID string
-	if i.Document != nil {
-		documentID = i.Document.Id()
+	documentID := i.DocumentID()
+	impact, err := encodeImpact(i.Impact)
+	if err != nil {
+		return err
 	}
 	if i.ID == 0 {
 		var result sql.Result
-		result, err = statement.Exec(i.severity, components, started, updated, i.Status, i.Description, documentID)
+		result, err = statement.Exec(i.severity, components, started, updated, i.Status, i.Description, documentID, i.Channel, impact)
+		if err != nil {
+			return err
+		}
 		i.ID, err = result.LastInsertId()
 	} else {
-		_, err = statement.Exec(i.severity, components, updated, i.Status, i.Description, documentID, i.ID)
+		_, err = statement.Exec(i.severity, components, updated, i.Status, i.Description, documentID, i.Channel, impact, i.ID)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if err := i.saveEvents(db); err != nil {
+		return err
+	}
+	// The search index is not critical, don't fail the whole save for it.
+	if err := indexIncident(db, i); err != nil {
+		log.Error("Could not index the incident for search", "error", err, "incident", i.ID)
+	}
+	return nil
 }
 
-// UpdateDescription updates the current description with an update.
-// If the description is not empty, a date header gets added to mark this as an update.
-func (i *Incident) UpdateDescription(update string) {
-	if i.Description != "" {
-		humanTime := time.Now().Format("15:04 Jan 2 2006")
-		i.Description += fmt.Sprintf("UPDATE %s\n", humanTime)
+// Severity returns the current severity of the incident.
+func (i *Incident) Severity() int64 {
+	return i.severity
+}
+
+// DocumentID returns the ID of the incident document, or an empty string if it has none.
+func (i *Incident) DocumentID() string {
+	if i.Document != nil {
+		return i.Document.Id()
 	}
-	i.Description += fmt.Sprintf("%s\n-- \n", update)
+	return i.documentID
+}
+
+// Components returns the components affected by the incident.
+func (i *Incident) Components() []string {
+	return i.components
+}
+
+// UpdateDescription replaces the current description with an update,
+// and records the update in the incident timeline.
+func (i *Incident) UpdateDescription(update string, author string) {
+	i.Description = update
+	i.updatedAt = time.Now()
+	i.AddEvent(EventDescription, author, update)
+}
+
+// SetSeverity changes the severity of the incident, recording the change in the timeline.
+func (i *Incident) SetSeverity(severity int64, author string) {
+	i.AddEvent(EventSeverity, author, fmt.Sprintf("%d -> %d", i.severity, severity))
+	i.severity = severity
+	i.updatedAt = time.Now()
+}
+
+// Close marks the incident as resolved, recording the change in the timeline.
+func (i *Incident) Close(author string) {
+	i.Status = StatusClosed
+	i.updatedAt = time.Now()
+	i.AddEvent(EventClose, author, "")
+}
+
+// Reopen puts a resolved incident back under investigation, recording the change in the timeline.
+func (i *Incident) Reopen(author string) {
+	i.Status = StatusOpen
+	i.updatedAt = time.Now()
+	i.AddEvent(EventReopen, author, "")
+}
+
+// SetStatus moves the incident to a new phase, recording the change in the timeline.
+// It returns an error if the transition is not allowed.
+func (i *Incident) SetStatus(status int64, author string) error {
+	if !CanTransition(i.Status, status) {
+		return fmt.Errorf("Cannot move an incident from %s to %s", StatusName(i.Status), StatusName(status))
+	}
+	switch {
+	case status == StatusClosed:
+		i.Close(author)
+	case i.Status == StatusClosed:
+		i.Reopen(author)
+	default:
+		i.AddEvent(EventStatus, author, fmt.Sprintf("%s -> %s", StatusName(i.Status), StatusName(status)))
+		i.Status = status
+		i.updatedAt = time.Now()
+	}
+	return nil
 }
 
 // Summary formats a simple summary of an incident
@@ -131,85 +225,126 @@ func (i *Incident) Summary(extended bool) string {
 	if i.Status == StatusClosed {
 		return "Up"
 	}
-	var severity string
-	if i.severity <= 3 {
-		severity = "degraded"
-	} else {
-		severity = "down"
-	}
+	severity := severitySummary(i.severity)
+	phase := StatusName(i.Status)
 	if extended && i.Document != nil {
-		return fmt.Sprintf("%s %s (#%d - docs at %s)", strings.Join(i.components, ", "), severity, i.ID, i.Document.Url())
+		return fmt.Sprintf("%s %s, %s (#%d - docs at %s)", strings.Join(i.components, ", "), severity, phase, i.ID, i.Document.Url())
 	}
-	return fmt.Sprintf("%s %s (#%d)", strings.Join(i.components, ", "), severity, i.ID)
+	return fmt.Sprintf("%s %s, %s (#%d)", strings.Join(i.components, ", "), severity, phase, i.ID)
 }
 
-func incidentFromDbRows(rows *sql.Rows) (*Incident, error) {
+// scanIncident reads an incident from the current row, without fetching its document.
+func scanIncident(rows *sql.Rows) (*Incident, error) {
 	inc := Incident{}
-	var components string
-	var updated string
-	var started string
-	var docId string
-	err := rows.Scan(&inc.ID, &inc.severity, &components, &started, &updated, &inc.Status, &inc.Description, &docId)
+	var components, started, updated, impact string
+	err := rows.Scan(&inc.ID, &inc.severity, &components, &started, &updated, &inc.Status, &inc.Description, &inc.documentID, &inc.Channel, &impact)
 	if err != nil {
 		return nil, err
 	}
+	if inc.Impact, err = decodeImpact(impact); err != nil {
+		return nil, err
+	}
 	inc.components = strings.Split(components, ", ")
-	inc.startedAt, err = time.Parse(time.RFC3339, started)
-	if err != nil {
+	if inc.startedAt, err = time.Parse(time.RFC3339, started); err != nil {
 		return nil, err
 	}
-	inc.updatedAt, err = time.Parse(time.RFC3339, updated)
+	if inc.updatedAt, err = time.Parse(time.RFC3339, updated); err != nil {
+		return nil, err
+	}
+	return &inc, nil
+}
+
+func incidentFromDbRows(rows *sql.Rows) (*Incident, error) {
+	inc, err := scanIncident(rows)
 	if err != nil {
 		return nil, err
 	}
-	doc := NewGoogleDoc()
-	if doc != nil {
-		if err := doc.GetFromId(docId); err != nil {
-			log.Error("Could not find the document", "id", doc, "error", err)
+	doc := NewDocument()
+	if doc != nil && inc.documentID != "" {
+		if err := doc.GetFromId(inc.documentID); err != nil {
+			log.Error("Could not find the document", "id", inc.documentID, "error", err)
 		} else {
 			inc.Document = doc
 		}
 	}
-	return &inc, err
+	return inc, nil
 }
 
-func getFromDb(statement *sql.Stmt, arg int64) ([]*Incident, error) {
-	rows, err := statement.Query(arg)
+// getFromDb runs the query, and returns the incidents. Fetching the documents needs
+// a round trip to the document backend for each incident, so only do it when needed.
+func getFromDb(statement *sql.Stmt, withDocuments bool, args ...interface{}) ([]*Incident, error) {
+	rows, err := statement.Query(args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var incidents []*Incident
 	for rows.Next() {
-		inc, err := incidentFromDbRows(rows)
+		var inc *Incident
+		if withDocuments {
+			inc, err = incidentFromDbRows(rows)
+		} else {
+			inc, err = scanIncident(rows)
+		}
 		if err != nil {
 			return nil, err
 		}
 		incidents = append(incidents, inc)
 	}
-	return incidents, err
+	return incidents, rows.Err()
 }
 
 // GetByID fetches one incident from the database
 func GetByID(db *sql.DB, id int64) (*Incident, error) {
-	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id from incidents WHERE id = ?")
+	return getByID(db, id, true)
+}
+
+func getByID(db *sql.DB, id int64, withDocument bool) (*Incident, error) {
+	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id, IFNULL(channel, ''), IFNULL(impact, '') from incidents WHERE id = ?")
 	if err != nil {
 		return nil, err
 	}
-	incidents, err := getFromDb(statement, id)
+	incidents, err := getFromDb(statement, withDocument, id)
 	if err != nil || incidents == nil {
 		return nil, err
 	}
 	return incidents[0], nil
 }
 
+// GetRecentIncidents returns the last updated incidents, open or closed, most recent first.
+func GetRecentIncidents(db *sql.DB, limit int64) ([]*Incident, error) {
+	return getRecentIncidents(db, limit, true)
+}
+
+func getRecentIncidents(db *sql.DB, limit int64, withDocuments bool) ([]*Incident, error) {
+	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id, IFNULL(channel, ''), IFNULL(impact, '') from incidents ORDER BY updated_at DESC LIMIT ?")
+	if err != nil {
+		return nil, err
+	}
+	return getFromDb(statement, withDocuments, limit)
+}
+
 // GetOpenIncidents returns the currently open incidents
 func GetOpenIncidents(db *sql.DB) ([]*Incident, error) {
-	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id from incidents WHERE status = ?")
+	return getOpenIncidents(db, true)
+}
+
+func getOpenIncidents(db *sql.DB, withDocuments bool) ([]*Incident, error) {
+	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id, IFNULL(channel, ''), IFNULL(impact, '') from incidents WHERE status != ?")
+	if err != nil {
+		return nil, err
+	}
+	return getFromDb(statement, withDocuments, StatusClosed)
+}
+
+// getAllIncidents returns all the incidents, oldest first. The documents are not
+// fetched, as it would be slow and useless when looking at many incidents.
+func getAllIncidents(db *sql.DB) ([]*Incident, error) {
+	statement, err := db.Prepare("SELECT id, severity, components, started_at, updated_at, status, description, document_id, IFNULL(channel, ''), IFNULL(impact, '') from incidents ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
-	return getFromDb(statement, StatusOpen)
+	return getFromDb(statement, false)
 }
 
 // IRC action functions
@@ -224,15 +359,35 @@ func updateTopic(irc *hbot.Bot, db *sql.DB, channel string, c *bot.Configuration
 	if err != nil {
 		return err
 	}
+	maintenances, err := GetActiveMaintenances(db)
+	if err != nil {
+		return err
+	}
 	var status string
 	// Status up
-	if incidents == nil {
+	if incidents == nil && maintenances == nil {
 		status = "Up"
 	} else {
 		var summaries []string
 		for _, incident := range incidents {
 			// Only publish a full summary (including the gdoc address) if in a public channel.
-			summaries = append(summaries, incident.Summary(c.IsPublicChannel(channel)))
+			summary := incident.Summary(c.IsPublicChannel(channel))
+			if linked, err := incident.linkedIDs(db); err != nil {
+				log.Error("Could not fetch the incident links", "error", err, "incident", incident.ID)
+			} else if linked != "" {
+				summary += fmt.Sprintf(" linked: %s", linked)
+			}
+			if c.TopicRoles && !c.IsPublicChannel(channel) {
+				if roles, err := incident.Roles(db); err != nil {
+					log.Error("Could not fetch the incident roles", "error", err, "incident", incident.ID)
+				} else if commander, ok := roles[RoleCommander]; ok {
+					summary += fmt.Sprintf(" IC: %s", commander)
+				}
+			}
+			summaries = append(summaries, summary)
+		}
+		for _, mw := range maintenances {
+			summaries = append(summaries, mw.Summary())
 		}
 		status = strings.Join(summaries, " / ")
 	}
@@ -266,16 +421,54 @@ func parseSeverity(severityString string, irc *hbot.Bot, m *hbot.Message) int64
 	return severity
 }
 
+// Publish saves the incident, and propagates the change to the webhooks, to the incident
+// document, to its dedicated channel and to the topic of all channels, paging people if needed. It returns the channels whose topic could not be updated.
+func (i *Incident) Publish(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) ([]string, error) {
+	event := i.webhookEvent()
+	if err := i.Save(db); err != nil {
+		return nil, err
+	}
+	webhook.Fire(c.Webhooks, event, WebhookPayload{Event: event, Incident: i.Payload()})
+	i.unpublished = false
+	if err := i.escalate(irc, db, c); err != nil {
+		log.Error("Could not page the people on call", "error", err, "incident", i.ID)
+	}
+	// Add the changes to the incident document in the background.
+	go func() {
+		if err := FlushDocumentUpdates(db); err != nil {
+			log.Error("Could not flush the document updates", "error", err)
+		}
+	}()
+	i.updateChannel(irc, c)
+	return updateAllTopics(irc, db, c), nil
+}
+
+// updateAllTopics updates the topic in all channels, and returns the channels where it failed.
+func updateAllTopics(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) []string {
+	var failed []string
+	for _, channel := range c.Channels {
+		if err := updateTopic(irc, db, channel, c); err != nil {
+			log.Error("Error updating the channel topic", "error", err.Error(), "channel", channel)
+			failed = append(failed, channel)
+		}
+	}
+	return failed
+}
+
 func saveIncident(incident *Incident, db *sql.DB, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration) bool {
-	err := incident.Save(db)
+	failed, err := incident.Publish(irc, db, c)
 	if err != nil {
 		irc.Reply(m, "Could not save the incident, please check the logs for errors")
 		log.Error("Could not update incident", "error", err.Error(), "incident", incident.ID)
 		return false
 	}
+	if err := incident.OpenChannel(irc, db, c, []string{m.Name}); err != nil {
+		irc.Reply(m, "Could not create the incident channel, please check the logs for errors")
+		log.Error("Could not create the incident channel", "error", err, "incident", incident.ID)
+	}
 
-	// Change the topic in all channels, report errors just to the issuer of the command in private.
-	for _, channel := range c.Channels {
+	// Report errors changing the topic just to the issuer of the command in private.
+	for _, channel := range failed {
 		// In general, we report failures in private to the issuer of the command. But if the channel is
 		// the one where the command was issued, respond in public.
 		// We therefore mangle m.To
@@ -283,10 +476,7 @@ func saveIncident(incident *Incident, db *sql.DB, irc *hbot.Bot, m *hbot.Message
 		if channel != m.To {
 			myMessage.To = irc.Nick
 		}
-		if err = updateTopic(irc, db, channel, c); err != nil {
-			irc.Reply(&myMessage, "Could not update the channel topic. Check my permissions please.")
-			log.Error("Error updating the channel topic", "error", err.Error())
-		}
+		irc.Reply(&myMessage, "Could not update the channel topic. Check my permissions please.")
 	}
 	return true
 }
@@ -294,22 +484,45 @@ func saveIncident(incident *Incident, db *sql.DB, irc *hbot.Bot, m *hbot.Message
 // startIncident handles starting an incident
 func startIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
 	splitRegex := regexp.MustCompile(",\\s*")
-	severity := parseSeverity(args[0], irc, m)
+	var tpl *bot.IncidentTemplateConfig
+	if args[0] != "" {
+		var err error
+		if tpl, err = GetIncidentTemplate(c, args[0]); err != nil {
+			irc.Reply(m, err.Error())
+			return true
+		}
+	}
+	severity := parseSeverity(args[1], irc, m)
 	if severity == 0 {
 		return true
 	}
-	components := splitRegex.Split(args[1], -1)
-	inc, err := NewIncident(severity, components, c)
+	var components []string
+	if args[2] != "" {
+		components = splitRegex.Split(strings.TrimSpace(args[2]), -1)
+	}
+	components = templateComponents(tpl, components)
+	if len(components) == 0 {
+		irc.Reply(m, "Please give the affected components: !incident_start <severity> <comp1>,[comp2,comp3..]")
+		return true
+	}
+	inc, err := NewIncident(severity, components, templateConfig(c, tpl), db)
 	if err != nil {
 		irc.Reply(m, "Invalid parameters: ")
 		irc.Reply(m, err.Error())
 		return true
 	}
+	text := fmt.Sprintf("severity %d, affecting %s", severity, strings.Join(inc.components, ", "))
+	if tpl != nil {
+		text += fmt.Sprintf(" (type %s)", tpl.Name)
+	}
+	inc.AddEvent(EventStart, m.Name, text)
 	if saveIncident(inc, db, irc, m, c) {
 		irc.Reply(m, fmt.Sprintf("Incident saved: %s", inc.Summary(true)))
+		postChecklist(irc, m, inc, tpl)
 	} else {
 		irc.Reply(m, "Error creating the incident, check the logs for details.")
-		log.Error("Error saving a new incident", "error", err.Error())
+		// saveIncident already logged the error.
+		log.Error("Error saving a new incident", "components", strings.Join(inc.components, ", "))
 	}
 	return true
 }
@@ -341,9 +554,19 @@ func stopIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configur
 		irc.Reply(m, "This incident is already closed.")
 		return true
 	}
-	inc.Status = StatusClosed
+	inc.Close(m.Name)
 	if saveIncident(inc, db, irc, m, c) {
 		irc.Reply(m, fmt.Sprintf("Incident closed: %d", inc.ID))
+		if c.ReportOnClose {
+			go func() {
+				if record, err := inc.WriteReport(db, c); err != nil {
+					irc.Reply(m, "Could not write the postmortem report, please check the logs.")
+					log.Error("Could not write the report", "error", err, "incident", inc.ID)
+				} else {
+					irc.Reply(m, fmt.Sprintf("Postmortem draft for incident %d: %s", inc.ID, record.Location()))
+				}
+			}()
+		}
 	} else {
 		irc.Reply(m, "Could not close the incident, see logs for details.")
 	}
@@ -357,16 +580,24 @@ func updateIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Config
 	}
 	if inc.Status == StatusClosed {
 		irc.Reply(m, fmt.Sprintf("Incident %d was closed, reopening it", inc.ID))
-		inc.Status = StatusOpen
+		inc.Reopen(m.Name)
 	}
-	if args[1] == "severity" {
+	switch args[1] {
+	case "severity":
 		severity := parseSeverity(args[2], irc, m)
 		if severity == 0 {
 			return true
 		}
-		inc.severity = severity
-	} else {
-		inc.UpdateDescription(args[2])
+		inc.SetSeverity(severity, m.Name)
+	case "impact":
+		impact, err := ParseImpact(args[2], inc.Impact, c)
+		if err != nil {
+			irc.Reply(m, err.Error())
+			return true
+		}
+		inc.SetImpact(impact, m.Name)
+	default:
+		inc.UpdateDescription(args[2], m.Name)
 	}
 	if saveIncident(inc, db, irc, m, c) {
 		irc.Reply(m, fmt.Sprintf("Incident %d updated.", inc.ID))
@@ -376,8 +607,30 @@ func updateIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Config
 	return true
 }
 
+func setIncidentStatus(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	status, err := ParseStatus(args[1])
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if err := inc.SetStatus(status, m.Name); err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if saveIncident(inc, db, irc, m, c) {
+		irc.Reply(m, fmt.Sprintf("Incident %d is now %s.", inc.ID, StatusName(inc.Status)))
+	} else {
+		irc.Reply(m, "Update failed. Please see the logs for details.")
+	}
+	return true
+}
+
 func listOpenIncidents(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
-	incidents, err := GetOpenIncidents(db)
+	incidents, err := getOpenIncidents(db, false)
 	if err != nil {
 		irc.Reply(m, "Could not retrieve the list of open incidents. Please check the logs")
 		log.Error("Could not retrieve the list of open incidents from the database", "error", err)
@@ -400,19 +653,53 @@ func formatIncident(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Config
 	if inc == nil {
 		return true
 	}
+	timeline, timelineErr := inc.Timeline(db)
+	if timelineErr != nil {
+		log.Error("Could not fetch the incident timeline", "error", timelineErr, "incident", inc.ID)
+	}
+	irc.Reply(m, "-- ")
 	if inc.Status == StatusClosed {
-		irc.Reply(m, fmt.Sprintf("Incident %d is closed. Last update was at %v", inc.ID, inc.updatedAt))
+		irc.Reply(m, fmt.Sprintf("== Incident #%d, resolved: %s, severity %d, from %s to %s", inc.ID, strings.Join(inc.components, ", "),
+			inc.severity, inc.startedAt.Format("2006-01-02 15:04"), inc.endedAt(timeline).Format("2006-01-02 15:04 MST")))
 	} else {
-		irc.Reply(m, "-- ")
 		irc.Reply(m, "== "+inc.Summary(false))
-		irc.Reply(m, "Description:")
-		for _, line := range strings.Split(inc.Description, "\n") {
-			irc.Reply(m, line)
+	}
+	if inc.Description != "" {
+		irc.Reply(m, "Description: "+inc.Description)
+	}
+	if !inc.Impact.IsEmpty() {
+		irc.Reply(m, "Impact: "+inc.Impact.String())
+	}
+	roles, err := inc.Roles(db)
+	if err != nil {
+		log.Error("Could not fetch the incident roles", "error", err, "incident", inc.ID)
+	}
+	for _, role := range Roles {
+		if nick, ok := roles[role]; ok {
+			irc.Reply(m, fmt.Sprintf("Incident %s: %s", role, nick))
 		}
-		if inc.Document != nil && inc.Document.Url() != "<not available>" {
-			irc.Reply(m, " \n")
-			irc.Reply(m, "Google Doc: "+inc.Document.Url())
+	}
+	if timelineErr != nil {
+		irc.Reply(m, "Could not fetch the timeline of the incident, please check the logs.")
+	} else {
+		irc.Reply(m, "Timeline:")
+		for _, event := range timeline {
+			irc.Reply(m, "  "+event.String())
 		}
 	}
+	links, err := inc.Links(db)
+	if err != nil {
+		log.Error("Could not fetch the incident links", "error", err, "incident", inc.ID)
+	}
+	for _, l := range links {
+		irc.Reply(m, "Linked incident: "+l.Describe(inc.ID))
+	}
+	if inc.Channel != "" {
+		irc.Reply(m, "Channel: "+inc.Channel)
+	}
+	if inc.Document != nil && inc.Document.Url() != "<not available>" {
+		irc.Reply(m, " \n")
+		irc.Reply(m, "Document: "+inc.Document.Url())
+	}
 	return false
 }
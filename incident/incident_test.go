@@ -0,0 +1,50 @@
+package incident
+
+import "testing"
+
+func TestSetStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  int64
+		to    int64
+		valid bool
+		event string
+	}{
+		{"identify", StatusInvestigating, StatusIdentified, true, EventStatus},
+		{"monitor", StatusIdentified, StatusMonitoring, true, EventStatus},
+		{"back to investigating", StatusMonitoring, StatusInvestigating, true, EventStatus},
+		{"resolve", StatusMonitoring, StatusResolved, true, EventClose},
+		{"reopen", StatusResolved, StatusInvestigating, true, EventReopen},
+		{"resolved to identified", StatusResolved, StatusIdentified, false, ""},
+		{"resolved to monitoring", StatusResolved, StatusMonitoring, false, ""},
+		{"same status", StatusIdentified, StatusIdentified, false, ""},
+		{"unknown status", StatusInvestigating, 42, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inc := Incident{ID: 1, Status: tt.from}
+			err := inc.SetStatus(tt.to, "alice")
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("moving from %s to %s should fail", StatusName(tt.from), StatusName(tt.to))
+				}
+				if inc.Status != tt.from || len(inc.pendingEvents) != 0 {
+					t.Errorf("a refused transition changed the incident: status %s, %d events", StatusName(inc.Status), len(inc.pendingEvents))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("moving from %s to %s failed: %v", StatusName(tt.from), StatusName(tt.to), err)
+			}
+			if inc.Status != tt.to {
+				t.Errorf("got status %s, want %s", StatusName(inc.Status), StatusName(tt.to))
+			}
+			if len(inc.pendingEvents) != 1 || inc.pendingEvents[0].Kind != tt.event {
+				t.Errorf("got events %+v, want a single %s event", inc.pendingEvents, tt.event)
+			}
+			if inc.updatedAt.IsZero() {
+				t.Error("the update time was not set")
+			}
+		})
+	}
+}
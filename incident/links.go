@@ -0,0 +1,267 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// Kinds of relationships between incidents.
+const (
+	// The incidents are related, e.g. one caused the other.
+	LinkRelated = "related"
+	// The first incident was a duplicate, and was merged into the second.
+	LinkDuplicate = "duplicate"
+)
+
+// Link is a relationship between two incidents.
+type Link struct {
+	From      int64
+	To        int64
+	Kind      string
+	Author    string
+	CreatedAt time.Time
+}
+
+// Other returns the id of the incident linked to the given one.
+func (l *Link) Other(id int64) int64 {
+	if l.From == id {
+		return l.To
+	}
+	return l.From
+}
+
+// Describe formats the link from the point of view of the given incident.
+func (l *Link) Describe(id int64) string {
+	switch {
+	case l.Kind == LinkDuplicate && l.From == id:
+		return fmt.Sprintf("duplicate of #%d", l.To)
+	case l.Kind == LinkDuplicate:
+		return fmt.Sprintf("#%d (merged into this one)", l.From)
+	default:
+		return fmt.Sprintf("#%d (%s)", l.Other(id), l.Kind)
+	}
+}
+
+// Save persists the link to the database.
+func (l *Link) Save(db Querier) error {
+	statement, err := db.Prepare("INSERT INTO incident_links (incident_id, linked_id, kind, created_by, created_at) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(l.From, l.To, l.Kind, l.Author, l.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// Links returns the relationships of the incident with other incidents, oldest first.
+func (i *Incident) Links(db *sql.DB) ([]*Link, error) {
+	statement, err := db.Prepare("SELECT incident_id, linked_id, kind, created_by, created_at FROM incident_links WHERE incident_id = ? OR linked_id = ? ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(i.ID, i.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []*Link
+	for rows.Next() {
+		l := Link{}
+		var created string
+		if err := rows.Scan(&l.From, &l.To, &l.Kind, &l.Author, &created); err != nil {
+			return nil, err
+		}
+		if l.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, err
+		}
+		links = append(links, &l)
+	}
+	return links, rows.Err()
+}
+
+// LinkTo records that the incident is related to another one, adding the link to both timelines.
+func (i *Incident) LinkTo(db *sql.DB, other *Incident, author string) error {
+	if i.ID == other.ID {
+		return fmt.Errorf("An incident cannot be linked to itself")
+	}
+	links, err := i.Links(db)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if l.Other(i.ID) == other.ID {
+			return fmt.Errorf("Incidents %d and %d are already linked", i.ID, other.ID)
+		}
+	}
+	l := Link{From: i.ID, To: other.ID, Kind: LinkRelated, Author: author, CreatedAt: time.Now()}
+	if err := l.Save(db); err != nil {
+		return err
+	}
+	i.AddEvent(EventLink, author, fmt.Sprintf("related to #%d", other.ID))
+	other.AddEvent(EventLink, author, fmt.Sprintf("related to #%d", i.ID))
+	return nil
+}
+
+// mergedEvents are the kinds of events copied from a duplicate to the incident it's merged into.
+// Events describing the lifecycle of the duplicate (start, severity, status...) are not copied,
+// as they would corrupt the severity history and the duration of the other incident.
+var mergedEvents = map[string]bool{
+	EventLog:         true,
+	EventDescription: true,
+	EventAlert:       true,
+	EventComms:       true,
+	EventAction:      true,
+	EventImpact:      true,
+}
+
+// MergeInto merges a duplicate incident into another one: its notes are copied, its
+// components and the worst severity are added, and it gets closed as a duplicate.
+// Both incidents are saved in a single transaction.
+func (i *Incident) MergeInto(db *sql.DB, dst *Incident, author string) error {
+	if i.ID == dst.ID {
+		return fmt.Errorf("An incident cannot be merged into itself")
+	}
+	if i.Status == StatusClosed {
+		return fmt.Errorf("Incident %d is already closed", i.ID)
+	}
+	if dst.Status == StatusClosed {
+		return fmt.Errorf("Incident %d is closed, reopen it first", dst.ID)
+	}
+	timeline, err := i.Timeline(db)
+	if err != nil {
+		return err
+	}
+	for _, e := range timeline {
+		if mergedEvents[e.Kind] {
+			text := fmt.Sprintf("merged from #%d: %s", i.ID, e.Text)
+			dst.pendingEvents = append(dst.pendingEvents, &Event{IncidentID: dst.ID, Kind: e.Kind, Author: e.Author, CreatedAt: e.CreatedAt, Text: text})
+		}
+	}
+	for _, name := range i.components {
+		found := false
+		for _, existing := range dst.components {
+			if existing == name {
+				found = true
+			}
+		}
+		if !found {
+			dst.components = append(dst.components, name)
+		}
+	}
+	if IsWorseSeverity(i.severity, dst.severity) {
+		dst.SetSeverity(i.severity, author)
+	}
+	text := fmt.Sprintf("merged #%d, affecting %s", i.ID, strings.Join(i.components, ", "))
+	if i.Document != nil {
+		if dst.Document == nil {
+			dst.Document = i.Document
+		}
+		text += fmt.Sprintf(" (document: %s)", i.Document.Url())
+	}
+	dst.AddEvent(EventMerge, author, text)
+	dst.updatedAt = time.Now()
+	i.AddEvent(EventMerge, author, fmt.Sprintf("duplicate of #%d, notes copied there", dst.ID))
+	i.Close(author)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	l := Link{From: i.ID, To: dst.ID, Kind: LinkDuplicate, Author: author, CreatedAt: time.Now()}
+	if err := l.Save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := dst.Save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := i.Save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// getDuplicateIDs returns the ids of the incidents that were merged into another one.
+func getDuplicateIDs(db *sql.DB) (map[int64]bool, error) {
+	statement, err := db.Prepare("SELECT incident_id FROM incident_links WHERE kind = ?")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(LinkDuplicate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// linkedIDs formats the ids of the incidents linked to the incident, for the topic.
+func (i *Incident) linkedIDs(db *sql.DB) (string, error) {
+	links, err := i.Links(db)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, l := range links {
+		ids = append(ids, fmt.Sprintf("#%d", l.Other(i.ID)))
+	}
+	return strings.Join(ids, ", "), nil
+}
+
+// getIncidentPair fetches the two incidents passed as parameters of a command.
+func getIncidentPair(args []string, irc *hbot.Bot, m *hbot.Message, db *sql.DB) (*Incident, *Incident) {
+	first := getIncidentFromIDParam(args[0], irc, m, db)
+	if first == nil {
+		return nil, nil
+	}
+	second := getIncidentFromIDParam(args[1], irc, m, db)
+	if second == nil {
+		return nil, nil
+	}
+	return first, second
+}
+
+// IRC actions
+func mergeIncidents(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	src, dst := getIncidentPair(args, irc, m, db)
+	if src == nil {
+		return true
+	}
+	if err := src.MergeInto(db, dst, m.Name); err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	// Both incidents are already saved, this propagates the changes.
+	if saveIncident(dst, db, irc, m, c) && saveIncident(src, db, irc, m, c) {
+		irc.Reply(m, fmt.Sprintf("Incident %d merged into %d: %s", src.ID, dst.ID, dst.Summary(false)))
+	}
+	return true
+}
+
+func linkIncidents(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	a, b := getIncidentPair(args, irc, m, db)
+	if a == nil {
+		return true
+	}
+	if err := a.LinkTo(db, b, m.Name); err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if saveIncident(a, db, irc, m, c) && saveIncident(b, db, irc, m, c) {
+		irc.Reply(m, fmt.Sprintf("Incidents %d and %d are now linked", a.ID, b.ID))
+	}
+	return true
+}
@@ -0,0 +1,395 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// State of a maintenance window.
+const (
+	MaintenanceScheduled int64 = iota
+	MaintenanceReminded
+	MaintenanceActive
+	MaintenanceDone
+	MaintenanceCancelled
+)
+
+// maintenanceTimeFormats are the formats accepted for the start and end of a window.
+var maintenanceTimeFormats = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02T15:04Z"}
+
+// Maintenance is a scheduled maintenance window.
+type Maintenance struct {
+	ID          int64
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Components  []string
+	Description string
+	Author      string
+	State       int64
+}
+
+// NewMaintenance creates a maintenance window, validating its components against the catalog.
+func NewMaintenance(start time.Time, end time.Time, components []string, description string, author string, c *bot.Configuration, db *sql.DB) (*Maintenance, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("The maintenance window must end after it starts")
+	}
+	if end.Before(time.Now()) {
+		return nil, fmt.Errorf("The maintenance window is in the past")
+	}
+	var normalized []string
+	for _, component := range components {
+		comp, err := LookupComponent(db, c, component)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, comp.Name)
+	}
+	return &Maintenance{StartsAt: start, EndsAt: end, Components: normalized, Description: description, Author: author}, nil
+}
+
+// ParseMaintenanceTime parses the start or end of a maintenance window.
+// Times without a timezone are considered UTC.
+func ParseMaintenanceTime(value string) (time.Time, error) {
+	for _, format := range maintenanceTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Could not parse '%s', please use the format 2006-01-02T15:04 (UTC)", value)
+}
+
+// Save persists the maintenance window to the database.
+func (mw *Maintenance) Save(db *sql.DB) error {
+	var query string
+	if mw.ID == 0 {
+		query = "INSERT INTO maintenances (starts_at, ends_at, components, description, author, state) VALUES (?, ?, ?, ?, ?, ?)"
+	} else {
+		query = "UPDATE maintenances SET starts_at=?, ends_at=?, components=?, description=?, author=?, state=? WHERE id = ?"
+	}
+	statement, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{
+		mw.StartsAt.UTC().Format(time.RFC3339),
+		mw.EndsAt.UTC().Format(time.RFC3339),
+		strings.Join(mw.Components, ", "),
+		mw.Description,
+		mw.Author,
+		mw.State,
+	}
+	if mw.ID != 0 {
+		_, err = statement.Exec(append(args, mw.ID)...)
+		return err
+	}
+	result, err := statement.Exec(args...)
+	if err != nil {
+		return err
+	}
+	mw.ID, err = result.LastInsertId()
+	return err
+}
+
+// IsActive tells you if the window is in progress at the given time.
+func (mw *Maintenance) IsActive(at time.Time) bool {
+	return !at.Before(mw.StartsAt) && at.Before(mw.EndsAt)
+}
+
+// Summary formats a simple summary of the maintenance window, for the topic.
+func (mw *Maintenance) Summary() string {
+	return fmt.Sprintf("%s maintenance until %s (M%d)", strings.Join(mw.Components, ", "), mw.EndsAt.UTC().Format("15:04 MST"), mw.ID)
+}
+
+// String formats the maintenance window as a single line, suitable for IRC.
+func (mw *Maintenance) String() string {
+	return fmt.Sprintf("M%d: %s, from %s to %s: %s", mw.ID, strings.Join(mw.Components, ", "),
+		mw.StartsAt.UTC().Format("2006-01-02 15:04"), mw.EndsAt.UTC().Format("2006-01-02 15:04 MST"), mw.Description)
+}
+
+// GetPendingMaintenances returns the maintenance windows that are not over or cancelled yet, by start time.
+func GetPendingMaintenances(db *sql.DB) ([]*Maintenance, error) {
+	statement, err := db.Prepare("SELECT id, starts_at, ends_at, components, description, author, state FROM maintenances WHERE state NOT IN (?, ?) ORDER BY starts_at")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(MaintenanceDone, MaintenanceCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var windows []*Maintenance
+	for rows.Next() {
+		mw := Maintenance{}
+		var starts, ends, components string
+		if err := rows.Scan(&mw.ID, &starts, &ends, &components, &mw.Description, &mw.Author, &mw.State); err != nil {
+			return nil, err
+		}
+		if mw.StartsAt, err = time.Parse(time.RFC3339, starts); err != nil {
+			return nil, err
+		}
+		if mw.EndsAt, err = time.Parse(time.RFC3339, ends); err != nil {
+			return nil, err
+		}
+		mw.Components = strings.Split(components, ", ")
+		windows = append(windows, &mw)
+	}
+	return windows, rows.Err()
+}
+
+// GetActiveMaintenances returns the maintenance windows in progress.
+func GetActiveMaintenances(db *sql.DB) ([]*Maintenance, error) {
+	windows, err := GetPendingMaintenances(db)
+	if err != nil {
+		return nil, err
+	}
+	var active []*Maintenance
+	now := time.Now()
+	for _, mw := range windows {
+		if mw.IsActive(now) {
+			active = append(active, mw)
+		}
+	}
+	return active, nil
+}
+
+// CancelMaintenance cancels a maintenance window that is not over yet, and returns it.
+func CancelMaintenance(db *sql.DB, id int64) (*Maintenance, error) {
+	windows, err := GetPendingMaintenances(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, mw := range windows {
+		if mw.ID != id {
+			continue
+		}
+		mw.State = MaintenanceCancelled
+		if err := mw.Save(db); err != nil {
+			return nil, err
+		}
+		return mw, nil
+	}
+	return nil, fmt.Errorf("There is no pending maintenance window M%d", id)
+}
+
+// announce sends a message to all the channels.
+func announce(irc *hbot.Bot, c *bot.Configuration, text string) {
+	for _, channel := range c.Channels {
+		irc.Msg(channel, text)
+	}
+}
+
+// checkMaintenances sends the reminders, and announces the start and the end of
+// the maintenance windows, updating the topics.
+func checkMaintenances(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) error {
+	windows, err := GetPendingMaintenances(db)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	reminder := time.Duration(c.MaintenanceReminder) * time.Minute
+	topicChanged := false
+	for _, mw := range windows {
+		state := mw.State
+		switch {
+		case !now.Before(mw.EndsAt):
+			if state == MaintenanceActive {
+				announce(irc, c, fmt.Sprintf("Maintenance window is over: %s", mw.String()))
+			}
+			state = MaintenanceDone
+		case mw.IsActive(now):
+			if state != MaintenanceActive {
+				announce(irc, c, fmt.Sprintf("Maintenance window started: %s", mw.String()))
+			}
+			state = MaintenanceActive
+		case reminder > 0 && state == MaintenanceScheduled && !now.Before(mw.StartsAt.Add(-reminder)):
+			announce(irc, c, fmt.Sprintf("Maintenance window starting in %s: %s", mw.StartsAt.Sub(now).Round(time.Minute), mw.String()))
+			state = MaintenanceReminded
+		}
+		if state == mw.State {
+			continue
+		}
+		if state == MaintenanceActive || mw.State == MaintenanceActive {
+			topicChanged = true
+		}
+		mw.State = state
+		if err := mw.Save(db); err != nil {
+			return err
+		}
+	}
+	if topicChanged {
+		updateAllTopics(irc, db, c)
+	}
+	return nil
+}
+
+// RunMaintenanceScheduler periodically checks the maintenance windows. It never returns.
+func RunMaintenanceScheduler(irc *hbot.Bot, db *sql.DB, c *bot.Configuration, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := checkMaintenances(irc, db, c); err != nil {
+			log.Error("Could not check the maintenance windows", "error", err)
+		}
+	}
+}
+
+// iCalendar export
+
+// icalEscape escapes text for use in iCalendar properties.
+func icalEscape(text string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\n", "\\n")
+	return replacer.Replace(text)
+}
+
+// icalFold splits a content line in lines of at most 75 octets, as required by RFC 5545.
+// Continuation lines start with a space, and UTF-8 sequences are never split.
+func icalFold(line string) []string {
+	var lines []string
+	prefix, max := "", 75
+	for len(line) > max {
+		cut := max
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		lines = append(lines, prefix+line[:cut])
+		line = line[cut:]
+		// The continuation lines have one octet less, because of the leading space.
+		prefix, max = " ", 74
+	}
+	return append(lines, prefix+line)
+}
+
+// MaintenanceCalendar renders the pending maintenance windows as an iCalendar.
+// Like on the status page, only the public components are mentioned, and the windows
+// only affecting internal components are left out.
+func MaintenanceCalendar(db *sql.DB, c *bot.Configuration) (string, error) {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		return "", err
+	}
+	public := make(map[string]bool)
+	for _, comp := range components {
+		public[comp.Name] = comp.Public
+	}
+	windows, err := GetPendingMaintenances(db)
+	if err != nil {
+		return "", err
+	}
+	const icalTime = "20060102T150405Z"
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//blabber//maintenance windows//EN"}
+	now := time.Now().UTC().Format(icalTime)
+	for _, mw := range windows {
+		var names []string
+		for _, name := range mw.Components {
+			if public[name] {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:maintenance-%d@blabber", mw.ID),
+			"DTSTAMP:"+now,
+			"DTSTART:"+mw.StartsAt.UTC().Format(icalTime),
+			"DTEND:"+mw.EndsAt.UTC().Format(icalTime),
+		)
+		lines = append(lines, icalFold("SUMMARY:"+icalEscape("Maintenance: "+strings.Join(names, ", ")))...)
+		lines = append(lines, icalFold("DESCRIPTION:"+icalEscape(mw.Description))...)
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+// RegisterMaintenanceCalendar adds the iCalendar export of the maintenance windows to the HTTP server.
+func RegisterMaintenanceCalendar(server *web.Server, db *sql.DB, c *bot.Configuration) {
+	server.Handle("/maintenance.ics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calendar, err := MaintenanceCalendar(db, c)
+		if err != nil {
+			log.Error("Could not build the maintenance calendar", "error", err)
+			http.Error(w, "Could not build the maintenance calendar", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Write([]byte(calendar))
+	}))
+}
+
+// IRC actions
+func scheduleMaintenance(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	start, err := ParseMaintenanceTime(args[0])
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	end, err := ParseMaintenanceTime(args[1])
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	splitRegex := regexp.MustCompile(",\\s*")
+	mw, err := NewMaintenance(start, end, splitRegex.Split(args[2], -1), args[3], m.Name, c, db)
+	if err != nil {
+		irc.Reply(m, "Invalid parameters: ")
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if err := mw.Save(db); err != nil {
+		irc.Reply(m, "Could not save the maintenance window, please check the logs for errors")
+		log.Error("Could not save the maintenance window", "error", err)
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("Maintenance window scheduled: %s", mw.String()))
+	// Update the topics right away if the window already started.
+	if err := checkMaintenances(irc, db, c); err != nil {
+		log.Error("Could not check the maintenance windows", "error", err)
+	}
+	return true
+}
+
+func cancelMaintenance(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[0], "M"), 10, 64)
+	if err != nil {
+		irc.Reply(m, "Couldn't parse the id of the maintenance window.")
+		return true
+	}
+	mw, err := CancelMaintenance(db, id)
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	announce(irc, c, fmt.Sprintf("Maintenance window cancelled by %s: %s", m.Name, mw.String()))
+	if mw.IsActive(time.Now()) {
+		updateAllTopics(irc, db, c)
+	}
+	return true
+}
+
+func listMaintenances(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	windows, err := GetPendingMaintenances(db)
+	if err != nil {
+		irc.Reply(m, "Could not retrieve the list of maintenance windows. Please check the logs")
+		log.Error("Could not retrieve the maintenance windows", "error", err)
+		return true
+	}
+	if len(windows) == 0 {
+		irc.Reply(m, "No maintenance windows scheduled.")
+		return true
+	}
+	irc.Reply(m, "Scheduled maintenance windows:")
+	for _, mw := range windows {
+		irc.Reply(m, fmt.Sprintf("  * %s", mw.String()))
+	}
+	return true
+}
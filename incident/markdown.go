@@ -0,0 +1,217 @@
+package incident
+
+import (
+	"blabber/bot"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultMarkdownTemplate is used when no template file is configured.
+const defaultMarkdownTemplate = `# {{.Title}}
+
+Incident document, created on {{.Date}}.
+
+## Summary
+
+## Impact
+
+## Timeline
+
+`
+
+// MarkdownDoc is a RemoteDocument implementation that writes Markdown files
+// to a local directory. It has no external dependencies.
+type MarkdownDoc struct {
+	Directory string
+	BaseURL   string
+	name      string
+}
+
+// markdownData is passed to the document template.
+type markdownData struct {
+	Title string
+	Date  string
+}
+
+// NewMarkdownDoc creates a new MarkdownDoc instance.
+func NewMarkdownDoc(c *bot.Configuration) *MarkdownDoc {
+	return &MarkdownDoc{Directory: c.DocDirectory, BaseURL: c.DocBaseURL}
+}
+
+// NewFromTemplate renders the template to a new file in the document directory.
+func (doc *MarkdownDoc) NewFromTemplate(title string, c *bot.Configuration) error {
+	source := defaultMarkdownTemplate
+	if c.DocTemplate != "" {
+		data, err := ioutil.ReadFile(c.DocTemplate)
+		if err != nil {
+			return fmt.Errorf("Could not read the document template: %v", err)
+		}
+		source = string(data)
+	}
+	tpl, err := template.New("document").Parse(source)
+	if err != nil {
+		return fmt.Errorf("Could not parse the document template: %v", err)
+	}
+	f, err := doc.create(title)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data := markdownData{Title: title, Date: time.Now().Format("2006-01-02 15:04 MST")}
+	if err := tpl.Execute(f, data); err != nil {
+		return fmt.Errorf("Could not render the document template: %v", err)
+	}
+	return nil
+}
+
+// NewFromText writes the content to a new file in the document directory.
+func (doc *MarkdownDoc) NewFromText(title string, content string, c *bot.Configuration) error {
+	f, err := doc.create(title)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return fmt.Errorf("Could not write the document: %v", err)
+	}
+	return nil
+}
+
+// create opens a new file for the document, with a name that is not in use yet.
+func (doc *MarkdownDoc) create(title string) (*os.File, error) {
+	if err := os.MkdirAll(doc.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create the document directory: %v", err)
+	}
+	base := slugify(title)
+	name := base + ".md"
+	for n := 1; ; n++ {
+		if _, err := os.Stat(filepath.Join(doc.Directory, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d.md", base, n)
+	}
+	f, err := os.OpenFile(filepath.Join(doc.Directory, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create the document: %v", err)
+	}
+	doc.name = name
+	return f, nil
+}
+
+// path returns the path of a document, making sure it's in the document directory:
+// ids can come from imported incidents, and must not be used to read or write other files.
+func (doc *MarkdownDoc) path(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("Invalid document id '%s'", name)
+	}
+	return filepath.Join(doc.Directory, name), nil
+}
+
+// GetFromId checks the file exists in the document directory.
+func (doc *MarkdownDoc) GetFromId(documentID string) error {
+	path, err := doc.path(documentID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("Could not find the document with id %s: %v", documentID, err)
+	}
+	doc.name = documentID
+	return nil
+}
+
+// Url returns the url you can reach your document at.
+func (doc *MarkdownDoc) Url() string {
+	if doc.name == "" {
+		return "<not available>"
+	}
+	if doc.BaseURL != "" {
+		return strings.TrimSuffix(doc.BaseURL, "/") + "/" + doc.name
+	}
+	path, err := filepath.Abs(filepath.Join(doc.Directory, doc.name))
+	if err != nil {
+		return "<not available>"
+	}
+	return "file://" + path
+}
+
+// Id returns the file name, relative to the document directory.
+func (doc *MarkdownDoc) Id() string {
+	return doc.name
+}
+
+// Append adds a list item at the end of the "Timeline" section of the document,
+// or at the end of the document if no such section exists.
+func (doc *MarkdownDoc) Append(text string) error {
+	path, err := doc.path(doc.name)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not read the document: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	// Find the end of the timeline section, skipping blank lines at its end.
+	index := len(lines)
+	sectionLevel := 0
+	for n, line := range lines {
+		level := markdownHeadingLevel(line)
+		if sectionLevel == 0 {
+			if level != 0 && strings.EqualFold(strings.TrimSpace(line[level:]), "timeline") {
+				sectionLevel = level
+			}
+		} else if level != 0 && level <= sectionLevel {
+			index = n
+			break
+		}
+	}
+	for index > 0 && strings.TrimSpace(lines[index-1]) == "" {
+		index--
+	}
+	entry := "- " + text
+	// Leave a blank line between the heading and the list.
+	if index > 0 && markdownHeadingLevel(lines[index-1]) != 0 {
+		entry = "\n" + entry
+	}
+	lines = append(lines[:index], append([]string{entry, ""}, lines[index:]...)...)
+	content := strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("Could not write the document: %v", err)
+	}
+	return nil
+}
+
+// Replace overwrites the file with the content.
+func (doc *MarkdownDoc) Replace(content string) error {
+	path, err := doc.path(doc.name)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("Could not write the document: %v", err)
+	}
+	return nil
+}
+
+// markdownHeadingLevel returns the level of an ATX heading, or 0 if the line is not a heading.
+func markdownHeadingLevel(line string) int {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 || (len(line) > level && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+var nonSlugChars = regexp.MustCompile("[^a-z0-9]+")
+
+// slugify turns a title into something usable as a file name.
+func slugify(title string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
@@ -0,0 +1,142 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Reminders nags people about open incidents that haven't been updated in a
+// while, and posts a daily digest of the open incidents.
+type Reminders struct {
+	irc    *hbot.Bot
+	db     *sql.DB
+	config *bot.Configuration
+	// When each incident was last nagged about.
+	nagged map[int64]time.Time
+	// When the last digest was posted.
+	digestAt time.Time
+}
+
+// NewReminders returns a new reminders scheduler.
+func NewReminders(irc *hbot.Bot, db *sql.DB, c *bot.Configuration) *Reminders {
+	r := Reminders{irc: irc, db: db, config: c, nagged: make(map[int64]time.Time)}
+	// Don't post a digest right away if the bot starts after the digest time.
+	if digest, err := r.digestTime(time.Now()); err == nil && time.Now().After(digest) {
+		r.digestAt = time.Now()
+	}
+	return &r
+}
+
+// ValidateReminders checks the reminders configuration when blabber starts, rather than
+// when the digest is due.
+func ValidateReminders(c *bot.Configuration) error {
+	if c.DigestTime == "" {
+		return nil
+	}
+	_, err := parseDigestTime(c.DigestTime)
+	return err
+}
+
+func parseDigestTime(value string) (time.Time, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Could not parse the digest time '%s': %v", value, err)
+	}
+	return t, nil
+}
+
+// staleAfter returns after how long an incident of the given severity is
+// considered stale if it has no updates, or 0 if it never is.
+func (r *Reminders) staleAfter(severity int64) time.Duration {
+	return time.Duration(r.config.StaleAfter[severity]) * time.Minute
+}
+
+// digestTime returns the time of the digest on the same day as the given time.
+func (r *Reminders) digestTime(now time.Time) (time.Time, error) {
+	t, err := parseDigestTime(r.config.DigestTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+}
+
+// nag reminds the commander of the incident, or all the channels if there is
+// none, that the incident needs an update.
+func (r *Reminders) nag(inc *Incident, now time.Time) {
+	text := fmt.Sprintf("Incident #%d has had no update for %s: %s. Please update it with !incident_update %d description <update>",
+		inc.ID, now.Sub(inc.updatedAt).Round(time.Minute), inc.Summary(false), inc.ID)
+	roles, err := inc.Roles(r.db)
+	if err != nil {
+		log.Error("Could not fetch the incident roles", "error", err, "incident", inc.ID)
+	}
+	if commander, ok := roles[RoleCommander]; ok {
+		r.irc.Msg(commander, text)
+		return
+	}
+	announce(r.irc, r.config, text)
+}
+
+// check nags about the stale incidents, and posts the digest when it's time.
+func (r *Reminders) check(now time.Time) error {
+	incidents, err := getOpenIncidents(r.db, false)
+	if err != nil {
+		return err
+	}
+	open := make(map[int64]bool)
+	for _, inc := range incidents {
+		open[inc.ID] = true
+		interval := r.staleAfter(inc.severity)
+		if interval <= 0 {
+			continue
+		}
+		last := inc.updatedAt
+		if nagged, ok := r.nagged[inc.ID]; ok && nagged.After(last) {
+			last = nagged
+		}
+		if now.Sub(last) >= interval {
+			r.nag(inc, now)
+			r.nagged[inc.ID] = now
+		}
+	}
+	// Forget about the incidents that were closed.
+	for id := range r.nagged {
+		if !open[id] {
+			delete(r.nagged, id)
+		}
+	}
+	if r.config.DigestTime == "" {
+		return nil
+	}
+	digest, err := r.digestTime(now)
+	if err != nil {
+		return err
+	}
+	if now.Before(digest) || !r.digestAt.Before(digest) {
+		return nil
+	}
+	r.digestAt = now
+	if len(incidents) == 0 {
+		return nil
+	}
+	announce(r.irc, r.config, fmt.Sprintf("Daily digest: %d incident(s) still open", len(incidents)))
+	for _, inc := range incidents {
+		announce(r.irc, r.config, fmt.Sprintf("  * %s, opened %s ago, last update %s ago", inc.Summary(false),
+			now.Sub(inc.startedAt).Round(time.Minute), now.Sub(inc.updatedAt).Round(time.Minute)))
+	}
+	return nil
+}
+
+// Run periodically checks the open incidents. It never returns.
+func (r *Reminders) Run(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		if err := r.check(now); err != nil {
+			log.Error("Could not check the open incidents", "error", err)
+		}
+	}
+}
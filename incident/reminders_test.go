@@ -0,0 +1,42 @@
+package incident
+
+import (
+	"blabber/bot"
+	"testing"
+	"time"
+)
+
+func TestValidateReminders(t *testing.T) {
+	tests := []struct {
+		digestTime string
+		valid      bool
+	}{
+		{"", true},
+		{"09:00", true},
+		{"23:59", true},
+		{"9am", false},
+		{"24:00", false},
+		{"09:00:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.digestTime, func(t *testing.T) {
+			err := ValidateReminders(&bot.Configuration{DigestTime: tt.digestTime})
+			if tt.valid != (err == nil) {
+				t.Errorf("got error %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDigestTime(t *testing.T) {
+	r := Reminders{config: &bot.Configuration{DigestTime: "09:30"}}
+	now := time.Date(2020, 3, 1, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*3600))
+	got, err := r.digestTime(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The digest time is in UTC, on the same day in UTC.
+	if want := time.Date(2020, 3, 2, 9, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
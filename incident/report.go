@@ -0,0 +1,344 @@
+package incident
+
+import (
+	"blabber/bot"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// defaultReportTemplate is used when no report template is configured.
+const defaultReportTemplate = `# Postmortem: incident #{{.ID}} - {{.Components}}
+
+## Summary
+
+Severity {{.Severity}} incident affecting {{.Components}}, {{.Status}}.
+{{if .Description}}
+{{.Description}}
+{{end}}
+* Started: {{.StartedAt.Format "2006-01-02 15:04 MST"}}
+* Resolved: {{if .Resolved}}{{.ClosedAt.Format "2006-01-02 15:04 MST"}}{{else}}not yet{{end}}
+* Duration: {{.Duration}}
+* Affected components: {{.Components}}
+{{- if not .Impact.IsEmpty}}
+* Impact: {{.Impact}}
+{{- end}}
+{{- if .DocumentURL}}
+* Incident document: {{.DocumentURL}}
+{{- end}}
+
+## Severity history
+{{range .SeverityHistory}}
+* Severity {{.Severity}} from {{.From.Format "15:04 Jan 2"}} to {{.To.Format "15:04 Jan 2"}} ({{.Duration}})
+{{- end}}
+
+## Participants
+{{range $role, $nick := .Roles}}
+* {{$nick}} ({{$role}})
+{{- end}}
+{{- range .Participants}}
+* {{.}}
+{{- end}}
+
+{{- if .Actions}}
+
+## Action items
+{{range .Actions}}
+* [{{if .IsDone}}x{{else}} {{end}}] {{.Text}} ({{.Owner}}{{if .Task}}, {{.Task}}{{end}})
+{{- end}}
+{{- end}}
+
+## Timeline
+{{range .Timeline}}
+* {{.}}
+{{- end}}
+`
+
+// SeverityPeriod is a period of time during which an incident had a given severity.
+type SeverityPeriod struct {
+	Severity int64
+	From     time.Time
+	To       time.Time
+}
+
+// Duration returns how long the period lasted.
+func (p SeverityPeriod) Duration() time.Duration {
+	return p.To.Sub(p.From)
+}
+
+// SeverityHistory reconstructs the severities of the incident over time from its timeline.
+// The last period ends when the incident was closed, or now if it's still open.
+func (i *Incident) SeverityHistory(timeline []*Event) []SeverityPeriod {
+	var history []SeverityPeriod
+	current := SeverityPeriod{Severity: i.severity, From: i.startedAt}
+	first := true
+	for _, e := range timeline {
+		if e.Kind != EventSeverity {
+			continue
+		}
+		var from, to int64
+		if _, err := fmt.Sscanf(e.Text, "%d -> %d", &from, &to); err != nil {
+			continue
+		}
+		if first {
+			current.Severity = from
+			first = false
+		}
+		current.To = e.CreatedAt
+		history = append(history, current)
+		current = SeverityPeriod{Severity: to, From: e.CreatedAt}
+	}
+	current.To = i.endedAt(timeline)
+	return append(history, current)
+}
+
+// endedAt returns when the incident was last closed, or the current time if it's open.
+func (i *Incident) endedAt(timeline []*Event) time.Time {
+	if i.Status != StatusClosed {
+		return time.Now()
+	}
+	ended := i.updatedAt
+	for _, e := range timeline {
+		if e.Kind == EventClose {
+			ended = e.CreatedAt
+		}
+	}
+	return ended
+}
+
+// Report contains all the data passed to the postmortem template.
+type Report struct {
+	ID              int64
+	Description     string
+	Components      string
+	Severity        int64
+	Status          string
+	Resolved        bool
+	StartedAt       time.Time
+	ClosedAt        time.Time
+	Duration        time.Duration
+	SeverityHistory []SeverityPeriod
+	Timeline        []*Event
+	// Who currently holds each role
+	Roles map[string]string
+	// Everyone else who took part in the incident
+	Participants []string
+	DocumentURL  string
+	Impact       Impact
+	// Follow-up tasks
+	Actions []*Action
+}
+
+// NewReport collects the data needed to write the postmortem of an incident.
+func NewReport(db *sql.DB, inc *Incident) (*Report, error) {
+	timeline, err := inc.Timeline(db)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := inc.Roles(db)
+	if err != nil {
+		return nil, err
+	}
+	actions, err := inc.Actions(db)
+	if err != nil {
+		return nil, err
+	}
+	r := Report{
+		ID:              inc.ID,
+		Description:     inc.Description,
+		Components:      strings.Join(inc.components, ", "),
+		Severity:        inc.severity,
+		Status:          StatusName(inc.Status),
+		Resolved:        inc.Status == StatusClosed,
+		StartedAt:       inc.startedAt,
+		ClosedAt:        inc.endedAt(timeline),
+		SeverityHistory: inc.SeverityHistory(timeline),
+		Timeline:        timeline,
+		Roles:           roles,
+		Impact:          inc.Impact,
+		Actions:         actions,
+	}
+	r.Duration = r.ClosedAt.Sub(r.StartedAt).Round(time.Minute)
+	if inc.Document != nil {
+		r.DocumentURL = inc.Document.Url()
+	}
+	// Participants are all the people who made changes to the incident, minus the role holders.
+	seen := make(map[string]bool)
+	for _, nick := range roles {
+		seen[nick] = true
+	}
+	for _, e := range timeline {
+		if !seen[e.Author] && e.Author != "" {
+			seen[e.Author] = true
+			r.Participants = append(r.Participants, e.Author)
+		}
+	}
+	sort.Strings(r.Participants)
+	return &r, nil
+}
+
+// Render renders the report with the configured template.
+func (r *Report) Render(c *bot.Configuration) (string, error) {
+	source := defaultReportTemplate
+	if c.ReportTemplate != "" {
+		data, err := ioutil.ReadFile(c.ReportTemplate)
+		if err != nil {
+			return "", fmt.Errorf("Could not read the report template: %v", err)
+		}
+		source = string(data)
+	}
+	tpl, err := template.New("report").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse the report template: %v", err)
+	}
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, r); err != nil {
+		return "", fmt.Errorf("Could not render the report template: %v", err)
+	}
+	return out.String(), nil
+}
+
+// ReportRecord tells where the postmortem report of an incident was written.
+type ReportRecord struct {
+	IncidentID int64
+	DocumentID string
+	Path       string
+	CreatedAt  time.Time
+	Document   RemoteDocument
+}
+
+// Location returns the link to the report document if available, or the path of the report file.
+func (r *ReportRecord) Location() string {
+	if r.Document != nil {
+		return r.Document.Url()
+	}
+	return r.Path
+}
+
+// Save persists the record to the database, replacing any previous report.
+func (r *ReportRecord) Save(db *sql.DB) error {
+	statement, err := db.Prepare("INSERT OR REPLACE INTO incident_reports (incident_id, document_id, path, created_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(r.IncidentID, r.DocumentID, r.Path, r.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetReportRecord fetches where the report for an incident was written.
+// It returns nil if no report was written yet.
+func GetReportRecord(db *sql.DB, incidentID int64) (*ReportRecord, error) {
+	r := ReportRecord{}
+	var created string
+	err := db.QueryRow(
+		"SELECT incident_id, document_id, path, created_at FROM incident_reports WHERE incident_id = ?",
+		incidentID).Scan(&r.IncidentID, &r.DocumentID, &r.Path, &created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if r.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+		return nil, err
+	}
+	if r.DocumentID != "" {
+		doc := NewDocument()
+		if doc != nil {
+			if err := doc.GetFromId(r.DocumentID); err != nil {
+				log.Error("Could not find the report document", "id", r.DocumentID, "error", err)
+			} else {
+				r.Document = doc
+			}
+		}
+	}
+	return &r, nil
+}
+
+// IsOutdated tells you if the incident changed since the report was written.
+func (r *ReportRecord) IsOutdated(inc *Incident) bool {
+	return inc.updatedAt.After(r.CreatedAt)
+}
+
+// WriteReport renders the postmortem report of the incident, and writes it to a document
+// and, if configured, to a file in the report directory. The document of the previous
+// report is reused, if any.
+func (i *Incident) WriteReport(db *sql.DB, c *bot.Configuration) (*ReportRecord, error) {
+	previous, err := GetReportRecord(db, i.ID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := NewReport(db, i)
+	if err != nil {
+		return nil, err
+	}
+	content, err := report.Render(c)
+	if err != nil {
+		return nil, err
+	}
+	record := ReportRecord{IncidentID: i.ID, CreatedAt: time.Now()}
+	title := fmt.Sprintf("Postmortem - incident %d - %s", i.ID, i.startedAt.Format("2006-01-02"))
+	if c.ReportDirectory != "" {
+		if err := os.MkdirAll(c.ReportDirectory, 0755); err != nil {
+			return nil, fmt.Errorf("Could not create the report directory: %v", err)
+		}
+		record.Path = filepath.Join(c.ReportDirectory, fmt.Sprintf("incident-%d.md", i.ID))
+		if err := ioutil.WriteFile(record.Path, []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf("Could not write the report: %v", err)
+		}
+	}
+	if previous != nil && previous.Document != nil {
+		// Keep the previous record if the update fails, so that it's retried the next time.
+		if err := previous.Document.Replace(content); err != nil {
+			return nil, err
+		}
+		record.DocumentID = previous.DocumentID
+		record.Document = previous.Document
+	} else if doc := NewDocument(); doc != nil {
+		if err := doc.NewFromText(title, content, c); err != nil {
+			log.Error("Could not write the report document", "error", err, "incident", i.ID)
+		} else {
+			record.DocumentID = doc.Id()
+			record.Document = doc
+		}
+	}
+	if record.Document == nil && record.Path == "" {
+		return nil, fmt.Errorf("The report could not be written anywhere")
+	}
+	return &record, record.Save(db)
+}
+
+// IRC actions
+func showReport(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	if inc.Status != StatusClosed {
+		irc.Reply(m, fmt.Sprintf("Incident %d is still open, close it before writing the postmortem.", inc.ID))
+		return true
+	}
+	record, err := GetReportRecord(db, inc.ID)
+	if err != nil {
+		log.Error("Could not fetch the report", "error", err, "incident", inc.ID)
+	}
+	// The timeline can still be updated after the incident is closed, e.g. with action items.
+	if record == nil || record.IsOutdated(inc) {
+		if record, err = inc.WriteReport(db, c); err != nil {
+			irc.Reply(m, "Could not write the postmortem report, please check the logs.")
+			log.Error("Could not write the report", "error", err, "incident", inc.ID)
+			return true
+		}
+	}
+	irc.Reply(m, fmt.Sprintf("Postmortem draft for incident %d: %s", inc.ID, record.Location()))
+	return true
+}
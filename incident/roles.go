@@ -0,0 +1,163 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/triggers"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// Roles people can have during an incident.
+const (
+	RoleCommander = "commander"
+	RoleComms     = "comms"
+	RoleScribe    = "scribe"
+)
+
+// Roles is the list of all the roles that can be assigned on an incident.
+var Roles = []string{RoleCommander, RoleComms, RoleScribe}
+
+// RoleAssignment records that someone took a role on an incident.
+// Assignments are never removed, so that handoffs can be reconstructed.
+type RoleAssignment struct {
+	IncidentID int64
+	Role       string
+	Nick       string
+	AssignedBy string
+	AssignedAt time.Time
+}
+
+// Save persists the role assignment to the database.
+func (r *RoleAssignment) Save(db *sql.DB) error {
+	statement, err := db.Prepare("INSERT INTO incident_roles (incident_id, role, nick, assigned_by, assigned_at) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(r.IncidentID, r.Role, r.Nick, r.AssignedBy, r.AssignedAt.Format(time.RFC3339))
+	return err
+}
+
+// AssignRole hands a role on the incident over to a new person. The handoff gets
+// recorded in the timeline, which will be persisted on the next save of the incident.
+func (i *Incident) AssignRole(db *sql.DB, role string, nick string, author string) error {
+	if !isRole(role) {
+		return fmt.Errorf("Unknown role '%s'", role)
+	}
+	roles, err := i.Roles(db)
+	if err != nil {
+		return err
+	}
+	previous, ok := roles[role]
+	if ok && previous == nick {
+		return fmt.Errorf("%s is already the %s of incident %d", nick, role, i.ID)
+	}
+	assignment := RoleAssignment{IncidentID: i.ID, Role: role, Nick: nick, AssignedBy: author, AssignedAt: time.Now()}
+	if err := assignment.Save(db); err != nil {
+		return err
+	}
+	if ok {
+		i.AddEvent(EventRole, author, fmt.Sprintf("%s: %s -> %s", role, previous, nick))
+	} else {
+		i.AddEvent(EventRole, author, fmt.Sprintf("%s: %s", role, nick))
+	}
+	i.updatedAt = time.Now()
+	return nil
+}
+
+// RoleHistory returns all the role assignments for the incident, oldest first.
+func (i *Incident) RoleHistory(db *sql.DB) ([]*RoleAssignment, error) {
+	statement, err := db.Prepare("SELECT incident_id, role, nick, assigned_by, assigned_at FROM incident_roles WHERE incident_id = ? ORDER BY assigned_at, rowid")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(i.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []*RoleAssignment
+	for rows.Next() {
+		r := RoleAssignment{}
+		var assigned string
+		if err := rows.Scan(&r.IncidentID, &r.Role, &r.Nick, &r.AssignedBy, &assigned); err != nil {
+			return nil, err
+		}
+		if r.AssignedAt, err = time.Parse(time.RFC3339, assigned); err != nil {
+			return nil, err
+		}
+		history = append(history, &r)
+	}
+	return history, rows.Err()
+}
+
+// RolesAt returns who held each role on the incident at a given time.
+func (i *Incident) RolesAt(db *sql.DB, at time.Time) (map[string]string, error) {
+	history, err := i.RoleHistory(db)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]string)
+	for _, assignment := range history {
+		if assignment.AssignedAt.After(at) {
+			break
+		}
+		roles[assignment.Role] = assignment.Nick
+	}
+	return roles, nil
+}
+
+// Roles returns who currently holds each role on the incident.
+func (i *Incident) Roles(db *sql.DB) (map[string]string, error) {
+	return i.RolesAt(db, time.Now())
+}
+
+func isRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleHolder returns a triggers.RoleResolver checking if the author of a command
+// currently holds the role on the incident whose id is the first argument of the command.
+func RoleHolder(role string) triggers.RoleResolver {
+	return func(args []string, m *hbot.Message, db *sql.DB) bool {
+		if len(args) == 0 {
+			return false
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		inc := Incident{ID: id}
+		roles, err := inc.Roles(db)
+		if err != nil {
+			return false
+		}
+		return roles[role] == m.Name
+	}
+}
+
+// IRC actions
+func assignRole(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	inc := getIncidentFromIDParam(args[0], irc, m, db)
+	if inc == nil {
+		return true
+	}
+	if err := inc.AssignRole(db, args[1], args[2], m.Name); err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if saveIncident(inc, db, irc, m, c) {
+		irc.Reply(m, fmt.Sprintf("%s is now the %s of incident %d.", args[2], args[1], inc.ID))
+	} else {
+		irc.Reply(m, "Update failed. Please see the logs for details.")
+	}
+	return true
+}
@@ -0,0 +1,269 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// searchPageSize is the number of incidents shown per page of search results.
+const searchPageSize = 5
+
+// dateRangeRegex matches a date range, e.g. 2026-01-01..2026-03-31. Either end can be omitted.
+var dateRangeRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})?\.\.(\d{4}-\d{2}-\d{2})?$`)
+
+// SearchQuery describes the incidents to look for.
+type SearchQuery struct {
+	// Words that must all appear in the incident, its components or its timeline
+	Words []string
+	// Components the incident must affect
+	Components []string
+	// The incident must have started in this period. Zero values mean no limit.
+	From time.Time
+	To   time.Time
+}
+
+// ParseSearchQuery parses a search from IRC. Every word of the query can be a date
+// range (2026-01-01..2026-03-31), a component from the catalog, or text to look for.
+func ParseSearchQuery(db *sql.DB, c *bot.Configuration, query string) (*SearchQuery, error) {
+	q := SearchQuery{}
+	for _, word := range strings.Fields(query) {
+		if matches := dateRangeRegex.FindStringSubmatch(word); matches != nil {
+			if matches[1] != "" {
+				from, err := time.ParseInLocation("2006-01-02", matches[1], time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid date range '%s': %v", word, err)
+				}
+				q.From = from
+			}
+			if matches[2] != "" {
+				to, err := time.ParseInLocation("2006-01-02", matches[2], time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid date range '%s': %v", word, err)
+				}
+				// The end date is included.
+				q.To = to.AddDate(0, 0, 1)
+			}
+			continue
+		}
+		if comp, err := LookupComponent(db, c, word); err == nil {
+			q.Components = append(q.Components, comp.Name)
+			continue
+		}
+		q.Words = append(q.Words, word)
+	}
+	return &q, nil
+}
+
+// matches tells you if the incident matches the components and the dates of the query.
+func (q *SearchQuery) matches(inc *Incident) bool {
+	if !q.From.IsZero() && inc.startedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !inc.startedAt.Before(q.To) {
+		return false
+	}
+	for _, name := range q.Components {
+		found := false
+		for _, affected := range inc.components {
+			if affected == name {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSearchIndex tells you if the full text search index exists. Older databases,
+// or SQLite builds without FTS, don't have it.
+func hasSearchIndex(db Querier) bool {
+	var name string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'incident_search'").Scan(&name)
+	return err == nil
+}
+
+// indexIncident adds the incident, with its timeline, to the full text search index.
+func indexIncident(db Querier, inc *Incident) error {
+	if !hasSearchIndex(db) {
+		return nil
+	}
+	timeline, err := inc.Timeline(db)
+	if err != nil {
+		return err
+	}
+	var texts []string
+	for _, e := range timeline {
+		texts = append(texts, e.Text)
+	}
+	statement, err := db.Prepare("DELETE FROM incident_search WHERE docid = ?")
+	if err != nil {
+		return err
+	}
+	if _, err := statement.Exec(inc.ID); err != nil {
+		return err
+	}
+	statement, err = db.Prepare("INSERT INTO incident_search (docid, components, description, timeline) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	_, err = statement.Exec(inc.ID, strings.Join(inc.components, ", "), inc.Description, strings.Join(texts, "\n"))
+	return err
+}
+
+// BackfillSearchIndex adds all the incidents to the full text search index if some are missing,
+// e.g. because the index was just created on an existing database.
+func BackfillSearchIndex(db *sql.DB) error {
+	if !hasSearchIndex(db) {
+		return nil
+	}
+	var indexed, total int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM incident_search").Scan(&indexed); err != nil {
+		return err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM incidents").Scan(&total); err != nil {
+		return err
+	}
+	if indexed >= total {
+		return nil
+	}
+	incidents, err := getAllIncidents(db)
+	if err != nil {
+		return err
+	}
+	for _, inc := range incidents {
+		if err := indexIncident(db, inc); err != nil {
+			return fmt.Errorf("Could not index incident %d: %v", inc.ID, err)
+		}
+	}
+	log.Info("Indexed the incidents for search", "incidents", len(incidents))
+	return nil
+}
+
+// searchText returns the ids of the incidents containing all the words, using the
+// full text search index if available, or a (slow) substring search otherwise.
+func searchText(db *sql.DB, words []string) (map[int64]bool, error) {
+	var query string
+	var args []interface{}
+	if hasSearchIndex(db) {
+		var terms []string
+		for _, word := range words {
+			// Quote the words, so that they're not interpreted as FTS operators.
+			terms = append(terms, `"`+strings.Replace(word, `"`, "", -1)+`"`)
+		}
+		query = "SELECT docid FROM incident_search WHERE incident_search MATCH ?"
+		args = append(args, strings.Join(terms, " "))
+	} else {
+		var conditions []string
+		for _, word := range words {
+			pattern := "%" + word + "%"
+			conditions = append(conditions, "(description LIKE ? OR components LIKE ? OR id IN (SELECT incident_id FROM incident_events WHERE text LIKE ?))")
+			args = append(args, pattern, pattern, pattern)
+		}
+		query = "SELECT id FROM incidents WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// Search returns the incidents matching the query, the most recent first.
+func Search(db *sql.DB, q *SearchQuery) ([]*Incident, error) {
+	var ids map[int64]bool
+	if len(q.Words) > 0 {
+		var err error
+		if ids, err = searchText(db, q.Words); err != nil {
+			return nil, err
+		}
+	}
+	incidents, err := getAllIncidents(db)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Incident
+	for _, inc := range incidents {
+		if ids != nil && !ids[inc.ID] {
+			continue
+		}
+		if q.matches(inc) {
+			results = append(results, inc)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID > results[j].ID })
+	return results, nil
+}
+
+// searchResult formats an incident as a line of search results.
+func searchResult(inc *Incident) string {
+	line := fmt.Sprintf("#%d [%s] severity %d, %s, started %s", inc.ID, StatusName(inc.Status), inc.severity,
+		strings.Join(inc.components, ", "), inc.startedAt.Format("2006-01-02 15:04 MST"))
+	if inc.Description != "" {
+		line += ": " + inc.Description
+	}
+	return line
+}
+
+// IRC actions
+func searchIncidents(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	page := 1
+	if args[1] != "" {
+		page, _ = strconv.Atoi(args[1])
+	}
+	q, err := ParseSearchQuery(db, c, args[0])
+	if err != nil {
+		irc.Reply(m, err.Error())
+		return true
+	}
+	results, err := Search(db, q)
+	if err != nil {
+		irc.Reply(m, "Could not search the incidents. Please check the logs")
+		log.Error("Could not search the incidents", "error", err, "query", args[0])
+		return true
+	}
+	if len(results) == 0 {
+		irc.Reply(m, "No incidents found.")
+		return true
+	}
+	pages := (len(results) + searchPageSize - 1) / searchPageSize
+	if page < 1 || page > pages {
+		irc.Reply(m, fmt.Sprintf("Invalid page, there are %d pages of results.", pages))
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("Found %d incident(s), page %d/%d:", len(results), page, pages))
+	end := page * searchPageSize
+	if end > len(results) {
+		end = len(results)
+	}
+	for _, inc := range results[(page-1)*searchPageSize : end] {
+		irc.Reply(m, "  * "+searchResult(inc))
+	}
+	if page < pages {
+		irc.Reply(m, fmt.Sprintf("Next page: !incident_search %s page %d", args[0], page+1))
+	}
+	return true
+}
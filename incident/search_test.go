@@ -0,0 +1,110 @@
+package incident
+
+import (
+	"blabber/bot"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("INSERT INTO components VALUES ('Search', 'cirrus, elastic', 'search', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	c := &bot.Configuration{Components: []bot.ComponentConfig{{Name: "Website", Aliases: []string{"www"}}}}
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+	}
+	tests := []struct {
+		query string
+		want  SearchQuery
+		valid bool
+	}{
+		{"", SearchQuery{}, true},
+		{"database timeout", SearchQuery{Words: []string{"database", "timeout"}}, true},
+		{"www elastic outage", SearchQuery{Components: []string{"Website", "Search"}, Words: []string{"outage"}}, true},
+		{"2026-01-01..2026-03-31", SearchQuery{From: day(2026, 1, 1), To: day(2026, 4, 1)}, true},
+		{"2026-01-01.. timeout", SearchQuery{From: day(2026, 1, 1), Words: []string{"timeout"}}, true},
+		{"..2026-02-28", SearchQuery{To: day(2026, 3, 1)}, true},
+		{"2026-02-30..2026-03-31", SearchQuery{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := ParseSearchQuery(db, c, tt.query)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("ParseSearchQuery(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSearchQuery(%q) failed: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got.Words, tt.want.Words) || !reflect.DeepEqual(got.Components, tt.want.Components) ||
+				!got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) {
+				t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := newTestDB(t)
+	incidents := []*Incident{
+		{severity: 2, components: []string{"Website"}, Description: "database timeout", Status: StatusClosed,
+			startedAt: time.Date(2026, 1, 10, 12, 0, 0, 0, time.Local)},
+		{severity: 3, components: []string{"Search", "Website"}, Description: "slow queries", Status: StatusOpen,
+			startedAt: time.Date(2026, 2, 10, 12, 0, 0, 0, time.Local)},
+	}
+	for _, inc := range incidents {
+		inc.updatedAt = inc.startedAt
+		inc.AddEvent(EventLog, "alice", "restarted the elastic cluster")
+		if err := inc.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	incidents[0].AddEvent(EventLog, "bob", "failed over the primary")
+	if err := incidents[0].Save(db); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []int64
+	}{
+		{"everything", SearchQuery{}, []int64{2, 1}},
+		{"description", SearchQuery{Words: []string{"timeout"}}, []int64{1}},
+		{"timeline", SearchQuery{Words: []string{"failed"}}, []int64{1}},
+		{"all the words", SearchQuery{Words: []string{"restarted", "slow"}}, []int64{2}},
+		{"no match", SearchQuery{Words: []string{"network"}}, nil},
+		{"component", SearchQuery{Components: []string{"Search"}}, []int64{2}},
+		{"all the components", SearchQuery{Components: []string{"Website", "Search"}}, []int64{2}},
+		{"from", SearchQuery{From: time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)}, []int64{2}},
+		{"to", SearchQuery{To: time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)}, []int64{1}},
+		{"words and dates", SearchQuery{Words: []string{"restarted"}, To: time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)}, []int64{1}},
+	}
+	run := func(t *testing.T) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				results, err := Search(db, &tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []int64
+				for _, inc := range results {
+					ids = append(ids, inc.ID)
+				}
+				if !reflect.DeepEqual(ids, tt.want) {
+					t.Errorf("got incidents %v, want %v", ids, tt.want)
+				}
+			})
+		}
+	}
+	t.Run("index", run)
+	// Older databases, or SQLite builds without FTS, don't have the index.
+	if _, err := db.Exec("DROP TABLE incident_search"); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("no index", run)
+}
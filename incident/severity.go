@@ -0,0 +1,44 @@
+package incident
+
+// Severities go from 5 (minor issue) to 1 (full outage): the lower the number, the worse
+// the incident. Severities are compared and described with the functions below only.
+const (
+	SeverityWorst   int64 = 1
+	SeverityMildest int64 = 5
+)
+
+// ValidSeverity tells you if a severity is between 1 and 5.
+func ValidSeverity(severity int64) bool {
+	return severity >= SeverityWorst && severity <= SeverityMildest
+}
+
+// IsWorseSeverity tells you if severity a is worse than severity b.
+func IsWorseSeverity(a int64, b int64) bool {
+	return a < b
+}
+
+// SeverityAtLeast tells you if a severity is as bad as the threshold, or worse.
+func SeverityAtLeast(severity int64, threshold int64) bool {
+	return !IsWorseSeverity(threshold, severity)
+}
+
+// componentStatus translates a severity into the status of the affected components.
+func componentStatus(severity int64) string {
+	switch {
+	case severity == SeverityWorst:
+		return ComponentMajor
+	case severity == SeverityWorst+1:
+		return ComponentPartial
+	default:
+		return ComponentDegraded
+	}
+}
+
+// severitySummary describes the affected components in the summary of an incident:
+// "down" for outages, "degraded" otherwise.
+func severitySummary(severity int64) string {
+	if componentStatus(severity) == ComponentDegraded {
+		return "degraded"
+	}
+	return "down"
+}
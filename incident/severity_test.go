@@ -0,0 +1,55 @@
+package incident
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSeverityWording(t *testing.T) {
+	tests := []struct {
+		severity int64
+		status   string
+		summary  string
+	}{
+		{1, ComponentMajor, "down"},
+		{2, ComponentPartial, "down"},
+		{3, ComponentDegraded, "degraded"},
+		{4, ComponentDegraded, "degraded"},
+		{5, ComponentDegraded, "degraded"},
+	}
+	for _, tt := range tests {
+		if status := componentStatus(tt.severity); status != tt.status {
+			t.Errorf("severity %d: got component status %q, want %q", tt.severity, status, tt.status)
+		}
+		inc := Incident{ID: 1, severity: tt.severity, components: []string{"Website"}, Status: StatusInvestigating}
+		if summary := inc.Summary(false); !strings.HasPrefix(summary, "Website "+tt.summary+",") {
+			t.Errorf("severity %d: got summary %q, want the components %s", tt.severity, summary, tt.summary)
+		}
+	}
+}
+
+func TestSeverityComparisons(t *testing.T) {
+	tests := []struct {
+		a, b    int64
+		worse   bool
+		atLeast bool
+	}{
+		{1, 2, true, true},
+		{2, 2, false, true},
+		{3, 2, false, false},
+		{5, 1, false, false},
+	}
+	for _, tt := range tests {
+		if worse := IsWorseSeverity(tt.a, tt.b); worse != tt.worse {
+			t.Errorf("IsWorseSeverity(%d, %d) = %t, want %t", tt.a, tt.b, worse, tt.worse)
+		}
+		if atLeast := SeverityAtLeast(tt.a, tt.b); atLeast != tt.atLeast {
+			t.Errorf("SeverityAtLeast(%d, %d) = %t, want %t", tt.a, tt.b, atLeast, tt.atLeast)
+		}
+	}
+	for severity := int64(0); severity <= 6; severity++ {
+		if valid := ValidSeverity(severity); valid != (severity >= 1 && severity <= 5) {
+			t.Errorf("ValidSeverity(%d) = %t", severity, valid)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package incident
+
+import (
+	"blabber/bot"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// ComponentStats are the statistics of the incidents affecting a component.
+type ComponentStats struct {
+	Name      string
+	Incidents int
+	Resolved  int
+	// Total time spent resolving the incidents affecting the component
+	TimeToResolve time.Duration
+	// Time spent at each severity by the incidents affecting the component
+	TimeAtSeverity map[int64]time.Duration
+	// Percentage of the SLO error budget consumed by the incidents affecting the component
+	SLOBudget float64
+}
+
+// MTTR returns the mean time to resolution of the incidents affecting the component.
+func (s *ComponentStats) MTTR() time.Duration {
+	if s.Resolved == 0 {
+		return 0
+	}
+	return s.TimeToResolve / time.Duration(s.Resolved)
+}
+
+// Stats are statistics about the incidents started in a period of time.
+type Stats struct {
+	Since     time.Time
+	Incidents int
+	Open      int
+	Resolved  int
+	// Number of incidents by the worst severity they reached
+	BySeverity map[int64]int
+	// Total time spent at each severity
+	TimeAtSeverity map[int64]time.Duration
+	// Total time spent resolving the closed incidents
+	TimeToResolve time.Duration
+	Components    map[string]*ComponentStats
+	// Number of incidents by region affected
+	ByRegion map[string]int
+	// Total percentage of the SLO error budget consumed
+	SLOBudget float64
+	// Sum of the estimated percentages of users affected, and number of incidents with an estimate
+	UsersAffected  float64
+	UsersEstimates int
+}
+
+// MTTR returns the mean time to resolution of the closed incidents.
+func (s *Stats) MTTR() time.Duration {
+	if s.Resolved == 0 {
+		return 0
+	}
+	return s.TimeToResolve / time.Duration(s.Resolved)
+}
+
+// MeanUsers returns the mean percentage of users affected by the incidents with an estimate.
+func (s *Stats) MeanUsers() float64 {
+	if s.UsersEstimates == 0 {
+		return 0
+	}
+	return s.UsersAffected / float64(s.UsersEstimates)
+}
+
+// Regions returns the regions affected in the period, the most affected first.
+func (s *Stats) Regions() []string {
+	var regions []string
+	for region := range s.ByRegion {
+		regions = append(regions, region)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if s.ByRegion[regions[i]] != s.ByRegion[regions[j]] {
+			return s.ByRegion[regions[i]] > s.ByRegion[regions[j]]
+		}
+		return regions[i] < regions[j]
+	})
+	return regions
+}
+
+// Severities returns the severities seen in the period, from the worst.
+func (s *Stats) Severities() []int64 {
+	var severities []int64
+	for sev := range s.TimeAtSeverity {
+		severities = append(severities, sev)
+	}
+	sort.Slice(severities, func(i, j int) bool { return IsWorseSeverity(severities[i], severities[j]) })
+	return severities
+}
+
+// ComponentList returns the statistics of the components, the most affected first.
+func (s *Stats) ComponentList() []*ComponentStats {
+	var components []*ComponentStats
+	for _, comp := range s.Components {
+		components = append(components, comp)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Incidents != components[j].Incidents {
+			return components[i].Incidents > components[j].Incidents
+		}
+		return components[i].Name < components[j].Name
+	})
+	return components
+}
+
+// GetStats computes statistics about the incidents started since the given time.
+// Incidents merged into another one are not counted.
+// The time spent at each severity is computed from the timeline when available.
+func GetStats(db *sql.DB, since time.Time) (*Stats, error) {
+	incidents, err := getAllIncidents(db)
+	if err != nil {
+		return nil, err
+	}
+	duplicates, err := getDuplicateIDs(db)
+	if err != nil {
+		return nil, err
+	}
+	stats := Stats{
+		Since:          since,
+		BySeverity:     make(map[int64]int),
+		TimeAtSeverity: make(map[int64]time.Duration),
+		Components:     make(map[string]*ComponentStats),
+		ByRegion:       make(map[string]int),
+	}
+	for _, inc := range incidents {
+		// Dates are stored with their offset, so they can't be compared in SQL.
+		if inc.startedAt.Before(since) || duplicates[inc.ID] {
+			continue
+		}
+		timeline, err := inc.Timeline(db)
+		if err != nil {
+			return nil, err
+		}
+		resolved := inc.Status == StatusClosed
+		duration := inc.endedAt(timeline).Sub(inc.startedAt)
+		stats.Incidents++
+		if resolved {
+			stats.Resolved++
+			stats.TimeToResolve += duration
+		} else {
+			stats.Open++
+		}
+		history := inc.SeverityHistory(timeline)
+		worst := inc.severity
+		for _, period := range history {
+			stats.TimeAtSeverity[period.Severity] += period.Duration()
+			if IsWorseSeverity(period.Severity, worst) {
+				worst = period.Severity
+			}
+		}
+		stats.BySeverity[worst]++
+		for _, region := range inc.Impact.Regions {
+			stats.ByRegion[region]++
+		}
+		stats.SLOBudget += inc.Impact.SLOBudget
+		if inc.Impact.Users != 0 {
+			stats.UsersAffected += inc.Impact.Users
+			stats.UsersEstimates++
+		}
+		for _, name := range inc.components {
+			comp, ok := stats.Components[name]
+			if !ok {
+				comp = &ComponentStats{Name: name, TimeAtSeverity: make(map[int64]time.Duration)}
+				stats.Components[name] = comp
+			}
+			comp.Incidents++
+			if resolved {
+				comp.Resolved++
+				comp.TimeToResolve += duration
+			}
+			for _, period := range history {
+				comp.TimeAtSeverity[period.Severity] += period.Duration()
+			}
+			comp.SLOBudget += inc.Impact.SLOBudget
+		}
+	}
+	return &stats, nil
+}
+
+// ParseSince parses the start of the period for statistics: either a date
+// (2006-01-02), a number of days (e.g. 90d) or a duration (e.g. 12h).
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("Could not parse '%s', please use a date (2006-01-02), a number of days (90d) or a duration (12h)", value)
+}
+
+// formatSeverityDurations formats the time spent at each severity.
+func formatSeverityDurations(durations map[int64]time.Duration, severities []int64) string {
+	var parts []string
+	for _, sev := range severities {
+		if d, ok := durations[sev]; ok {
+			parts = append(parts, fmt.Sprintf("sev%d %s", sev, d.Round(time.Minute)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IRC actions
+func showStats(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	var since time.Time
+	period := "ever"
+	if args[0] != "" {
+		var err error
+		if since, err = ParseSince(args[0], time.Now()); err != nil {
+			irc.Reply(m, err.Error())
+			return true
+		}
+		period = "since " + since.Format("2006-01-02 15:04 MST")
+	}
+	stats, err := GetStats(db, since)
+	if err != nil {
+		irc.Reply(m, "Could not compute the statistics. Please check the logs")
+		log.Error("Could not compute the incident statistics", "error", err)
+		return true
+	}
+	if stats.Incidents == 0 {
+		irc.Reply(m, fmt.Sprintf("No incidents %s.", period))
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("Incidents %s: %d (%d open, %d resolved). MTTR: %s",
+		period, stats.Incidents, stats.Open, stats.Resolved, stats.MTTR().Round(time.Minute)))
+	severities := stats.Severities()
+	var counts []string
+	for _, sev := range severities {
+		if n, ok := stats.BySeverity[sev]; ok {
+			counts = append(counts, fmt.Sprintf("sev%d %d", sev, n))
+		}
+	}
+	irc.Reply(m, fmt.Sprintf("By worst severity: %s", strings.Join(counts, ", ")))
+	irc.Reply(m, fmt.Sprintf("Time at each severity: %s", formatSeverityDurations(stats.TimeAtSeverity, severities)))
+	if stats.SLOBudget != 0 || stats.UsersEstimates != 0 {
+		irc.Reply(m, fmt.Sprintf("Impact: %s%% of the SLO budget consumed, %s%% of users affected on average (%d incident(s) with an estimate)",
+			formatFigure(stats.SLOBudget), strconv.FormatFloat(stats.MeanUsers(), 'f', 1, 64), stats.UsersEstimates))
+	}
+	if regions := stats.Regions(); len(regions) > 0 {
+		var counts []string
+		for _, region := range regions {
+			counts = append(counts, fmt.Sprintf("%s %d", region, stats.ByRegion[region]))
+		}
+		irc.Reply(m, fmt.Sprintf("By region: %s", strings.Join(counts, ", ")))
+	}
+	irc.Reply(m, "By component:")
+	for _, comp := range stats.ComponentList() {
+		line := fmt.Sprintf("  * %s: %d incident(s), MTTR %s, %s", comp.Name, comp.Incidents,
+			comp.MTTR().Round(time.Minute), formatSeverityDurations(comp.TimeAtSeverity, severities))
+		if comp.SLOBudget != 0 {
+			line += fmt.Sprintf(", %s%% of the SLO budget", formatFigure(comp.SLOBudget))
+		}
+		irc.Reply(m, line)
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		value string
+		want  time.Time
+		valid bool
+	}{
+		{"2026-01-01", time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), true},
+		{"90d", now.AddDate(0, 0, -90), true},
+		{"0d", now, true},
+		{"12h", now.Add(-12 * time.Hour), true},
+		{"1h30m", now.Add(-90 * time.Minute), true},
+		{"-5d", time.Time{}, false},
+		{"-1h", time.Time{}, false},
+		{"2026-13-01", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSince(tt.value, now)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("ParseSince(%q) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSince(%q) failed: %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	testCommand(t, "incident_stats", []commandTest{
+		{"!incident_stats", []string{""}},
+		{"!incident_stats ", []string{""}},
+		{"!incident_stats 90d", []string{"90d"}},
+		{"!incident_stats   2026-01-01  ", []string{"2026-01-01"}},
+		{"BlabberBot: !incident_stats 12h", []string{"12h"}},
+		{"!incident_stats90d", nil},
+		{"!incident_stats 90d 12h", nil},
+	})
+}
+
+func TestGetStats(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	// saveIncident saves an incident whose timeline has events at the given offsets from its start.
+	saveIncident := func(inc *Incident, events map[time.Duration][2]string) {
+		inc.updatedAt = inc.startedAt
+		for offset, event := range events {
+			e := inc.AddEvent(event[0], "alice", event[1])
+			e.CreatedAt = inc.startedAt.Add(offset)
+		}
+		if err := inc.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Went from severity 3 to 1 after 30 minutes, resolved in 2 hours.
+	saveIncident(&Incident{severity: 1, components: []string{"Website", "Search"}, Status: StatusClosed, startedAt: start,
+		Impact: Impact{Regions: []string{"eqiad"}, Users: 20, SLOBudget: 10}},
+		map[time.Duration][2]string{30 * time.Minute: {EventSeverity, "3 -> 1"}, 2 * time.Hour: {EventClose, ""}})
+	// Resolved in 1 hour.
+	duplicated := &Incident{severity: 4, components: []string{"Website"}, Status: StatusClosed, startedAt: start.AddDate(0, 0, 1),
+		Impact: Impact{Regions: []string{"eqiad", "codfw"}, SLOBudget: 5}}
+	saveIncident(duplicated, map[time.Duration][2]string{time.Hour: {EventClose, ""}})
+	// Still open.
+	saveIncident(&Incident{severity: 2, components: []string{"Search"}, Status: StatusOpen, startedAt: start.AddDate(0, 0, 2)}, nil)
+	// Merged into the second one, not counted.
+	duplicate := &Incident{severity: 1, components: []string{"Website"}, Status: StatusClosed, startedAt: start.AddDate(0, 0, 1)}
+	saveIncident(duplicate, map[time.Duration][2]string{time.Hour: {EventClose, ""}})
+	link := Link{From: duplicate.ID, To: duplicated.ID, Kind: LinkDuplicate, Author: "alice", CreatedAt: start}
+	if err := link.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	// Before the period.
+	saveIncident(&Incident{severity: 5, components: []string{"Thumbnails"}, Status: StatusClosed, startedAt: start.AddDate(0, 0, -10)},
+		map[time.Duration][2]string{time.Hour: {EventClose, ""}})
+
+	stats, err := GetStats(db, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var components []string
+	for _, comp := range stats.ComponentList() {
+		components = append(components, comp.Name)
+	}
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"incidents", stats.Incidents, 3},
+		{"open", stats.Open, 1},
+		{"resolved", stats.Resolved, 2},
+		{"MTTR", stats.MTTR(), 90 * time.Minute},
+		{"by worst severity", stats.BySeverity, map[int64]int{1: 1, 2: 1, 4: 1}},
+		{"severities", stats.Severities(), []int64{1, 2, 3, 4}},
+		{"time at severity 1", stats.TimeAtSeverity[1], 90 * time.Minute},
+		{"time at severity 3", stats.TimeAtSeverity[3], 30 * time.Minute},
+		{"time at severity 4", stats.TimeAtSeverity[4], time.Hour},
+		{"regions", stats.Regions(), []string{"eqiad", "codfw"}},
+		{"SLO budget", stats.SLOBudget, 15.0},
+		{"mean users", stats.MeanUsers(), 20.0},
+		{"components", components, []string{"Search", "Website"}},
+		{"website incidents", stats.Components["Website"].Incidents, 2},
+		{"website MTTR", stats.Components["Website"].MTTR(), 90 * time.Minute},
+		{"website SLO budget", stats.Components["Website"].SLOBudget, 15.0},
+		{"search incidents", stats.Components["Search"].Incidents, 2},
+		{"search MTTR", stats.Components["Search"].MTTR(), 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	stats, err = GetStats(db, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Incidents != 4 || stats.Components["Thumbnails"] == nil {
+		t.Errorf("got %d incidents since ever, want 4 including Thumbnails", stats.Incidents)
+	}
+}
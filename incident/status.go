@@ -0,0 +1,61 @@
+package incident
+
+import "fmt"
+
+// Status of the incident.
+const (
+	StatusOpen int64 = iota
+	StatusClosed
+	StatusIdentified
+	StatusMonitoring
+)
+
+// Names of the phases of our incident process. An open incident
+// is being investigated, a closed one is resolved.
+const (
+	StatusInvestigating = StatusOpen
+	StatusResolved      = StatusClosed
+)
+
+var statusNames = map[int64]string{
+	StatusInvestigating: "investigating",
+	StatusIdentified:    "identified",
+	StatusMonitoring:    "monitoring",
+	StatusResolved:      "resolved",
+}
+
+// transitions lists, for every status, the statuses it can move to.
+var transitions = map[int64][]int64{
+	StatusInvestigating: {StatusIdentified, StatusMonitoring, StatusResolved},
+	StatusIdentified:    {StatusInvestigating, StatusMonitoring, StatusResolved},
+	StatusMonitoring:    {StatusInvestigating, StatusIdentified, StatusResolved},
+	StatusResolved:      {StatusInvestigating},
+}
+
+// StatusName returns the human-readable name of a status.
+func StatusName(status int64) string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseStatus returns the status corresponding to a name.
+func ParseStatus(name string) (int64, error) {
+	for status, statusName := range statusNames {
+		if name == statusName {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown incident status '%s'", name)
+}
+
+// CanTransition tells you if an incident can move from one status to another.
+func CanTransition(from int64, to int64) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package incident
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Status of a component as shown on the status page.
+const (
+	ComponentOperational = "operational"
+	ComponentDegraded    = "degraded performance"
+	ComponentPartial     = "partial outage"
+	ComponentMajor       = "major outage"
+)
+
+// statusPageTTL is how long the status is cached before being computed again.
+const statusPageTTL = 30 * time.Second
+
+// ComponentStatus is the status of a public component.
+type ComponentStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Incidents []int64 `json:"incidents"`
+}
+
+// PublicIncident is the view of an open incident that can be shown to the public.
+// It only includes public components, and never the link to the incident document.
+type PublicIncident struct {
+	ID         int64     `json:"id"`
+	Summary    string    `json:"summary"`
+	Severity   int64     `json:"severity"`
+	Status     string    `json:"status"`
+	Components []string  `json:"components"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PublicStatus is the overall status shown on the status page.
+type PublicStatus struct {
+	Status     string             `json:"status"`
+	Components []*ComponentStatus `json:"components"`
+	Incidents  []*PublicIncident  `json:"incidents"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+// GetPublicStatus computes the status of all public components from the open incidents.
+// Incidents only affecting internal components are not included.
+func GetPublicStatus(db *sql.DB, c *bot.Configuration) (*PublicStatus, error) {
+	components, err := GetComponents(db, c)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := getOpenIncidents(db, false)
+	if err != nil {
+		return nil, err
+	}
+	status := PublicStatus{Status: ComponentOperational, UpdatedAt: time.Now()}
+	worst := make(map[string]int64)
+	for _, comp := range components {
+		if !comp.Public {
+			continue
+		}
+		status.Components = append(status.Components, &ComponentStatus{Name: comp.Name, Status: ComponentOperational})
+	}
+	for _, inc := range incidents {
+		var public []string
+		for _, name := range inc.components {
+			for _, comp := range status.Components {
+				if comp.Name == name {
+					public = append(public, name)
+					comp.Incidents = append(comp.Incidents, inc.ID)
+					if sev, ok := worst[name]; !ok || IsWorseSeverity(inc.severity, sev) {
+						worst[name] = inc.severity
+						comp.Status = componentStatus(inc.severity)
+					}
+				}
+			}
+		}
+		if public == nil {
+			continue
+		}
+		// Build the summary like Summary(false) does, but without internal components.
+		publicInc := Incident{ID: inc.ID, severity: inc.severity, components: public, Status: inc.Status}
+		status.Incidents = append(status.Incidents, &PublicIncident{
+			ID:         inc.ID,
+			Summary:    publicInc.Summary(false),
+			Severity:   inc.severity,
+			Status:     StatusName(inc.Status),
+			Components: public,
+			StartedAt:  inc.startedAt,
+			UpdatedAt:  inc.updatedAt,
+		})
+	}
+	var overall int64
+	for _, sev := range worst {
+		if overall == 0 || IsWorseSeverity(sev, overall) {
+			overall = sev
+		}
+	}
+	if overall != 0 {
+		status.Status = componentStatus(overall)
+	}
+	return &status, nil
+}
+
+// cssClass returns the css class for a status.
+func cssClass(status string) string {
+	return strings.Replace(status, " ", "-", -1)
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{"class": cssClass}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+.operational { color: #14866d; }
+.degraded-performance { color: #ac6600; }
+.partial-outage, .major-outage { color: #d33; }
+li { margin: 0.3em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<h2 class="{{class .Status.Status}}">Status: {{.Status.Status}}</h2>
+<h3>Components</h3>
+<ul>
+{{- range .Status.Components}}
+<li>{{.Name}}: <span class="{{class .Status}}">{{.Status}}</span></li>
+{{- end}}
+</ul>
+{{- if .Status.Incidents}}
+<h3>Open incidents</h3>
+<ul>
+{{- range .Status.Incidents}}
+<li>{{.Summary}}, since {{.StartedAt.Format "2006-01-02 15:04 MST"}} (last update {{.UpdatedAt.Format "2006-01-02 15:04 MST"}})</li>
+{{- end}}
+</ul>
+{{- end}}
+<p><small>Last checked {{.Status.UpdatedAt.Format "2006-01-02 15:04:05 MST"}}. Also available as <a href="status.json">JSON</a>.</small></p>
+</body>
+</html>
+`))
+
+// statusPage serves the public status page, caching the status for a short time.
+type statusPage struct {
+	db     *sql.DB
+	config *bot.Configuration
+	lock   sync.Mutex
+	status *PublicStatus
+}
+
+func (p *statusPage) get() (*PublicStatus, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.status == nil || time.Since(p.status.UpdatedAt) > statusPageTTL {
+		status, err := GetPublicStatus(p.db, p.config)
+		if err != nil {
+			return nil, err
+		}
+		p.status = status
+	}
+	return p.status, nil
+}
+
+// RegisterStatusPage adds the public status page and its JSON endpoint to the HTTP server.
+func RegisterStatusPage(server *web.Server, db *sql.DB, c *bot.Configuration) {
+	p := &statusPage{db: db, config: c}
+	server.Handle("/", http.HandlerFunc(p.serveHTML))
+	server.Handle("/status.json", http.HandlerFunc(p.serveJSON))
+}
+
+func (p *statusPage) serveHTML(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	status, err := p.get()
+	if err != nil {
+		log.Error("Could not compute the status page", "error", err)
+		http.Error(w, "Could not compute the current status", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Title  string
+		Status *PublicStatus
+	}{p.config.StatusPageTitle, status}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, data); err != nil {
+		log.Error("Could not render the status page", "error", err)
+	}
+}
+
+func (p *statusPage) serveJSON(w http.ResponseWriter, r *http.Request) {
+	status, err := p.get()
+	if err != nil {
+		log.Error("Could not compute the status page", "error", err)
+		http.Error(w, "Could not compute the current status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Error("Could not encode the status", "error", err)
+	}
+}
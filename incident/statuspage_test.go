@@ -0,0 +1,53 @@
+package incident
+
+import (
+	"blabber/bot"
+	"testing"
+	"time"
+)
+
+func TestPublicStatus(t *testing.T) {
+	db := newTestDB(t)
+	c := &bot.Configuration{Components: []bot.ComponentConfig{
+		{Name: "Website", Public: true}, {Name: "Search", Public: true}, {Name: "Thumbnails", Public: true}, {Name: "Databases"},
+	}}
+	for _, inc := range []*Incident{
+		{severity: 3, components: []string{"Website"}, Status: StatusOpen},
+		{severity: 1, components: []string{"Website", "Databases"}, Status: StatusIdentified},
+		{severity: 2, components: []string{"Search"}, Status: StatusMonitoring},
+		{severity: 1, components: []string{"Databases"}, Status: StatusOpen},
+		{severity: 1, components: []string{"Thumbnails"}, Status: StatusClosed},
+	} {
+		inc.startedAt, inc.updatedAt = time.Now(), time.Now()
+		if err := inc.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, err := GetPublicStatus(db, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != ComponentMajor {
+		t.Errorf("got overall status %q, want %q", status.Status, ComponentMajor)
+	}
+	want := map[string]string{"Website": ComponentMajor, "Search": ComponentPartial, "Thumbnails": ComponentOperational}
+	for _, comp := range status.Components {
+		if comp.Status != want[comp.Name] {
+			t.Errorf("%s: got status %q, want %q", comp.Name, comp.Status, want[comp.Name])
+		}
+		delete(want, comp.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing components %v, internal ones must not be shown", want)
+	}
+	summaries := map[int64]string{1: "Website degraded, investigating (#1)", 2: "Website down, identified (#2)", 3: "Search down, monitoring (#3)"}
+	for _, inc := range status.Incidents {
+		if inc.Summary != summaries[inc.ID] {
+			t.Errorf("incident %d: got summary %q, want %q", inc.ID, inc.Summary, summaries[inc.ID])
+		}
+		delete(summaries, inc.ID)
+	}
+	if len(summaries) != 0 {
+		t.Errorf("missing incidents %v", summaries)
+	}
+}
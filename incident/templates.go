@@ -0,0 +1,73 @@
+package incident
+
+import (
+	"blabber/bot"
+	"fmt"
+	"strings"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// GetIncidentTemplate returns the configuration of a type of incident.
+func GetIncidentTemplate(c *bot.Configuration, name string) (*bot.IncidentTemplateConfig, error) {
+	var names []string
+	for n := range c.IncidentTemplates {
+		if c.IncidentTemplates[n].Name == name {
+			return &c.IncidentTemplates[n], nil
+		}
+		names = append(names, c.IncidentTemplates[n].Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Unknown incident type '%s', no types are configured", name)
+	}
+	return nil, fmt.Errorf("Unknown incident type '%s', known types are: %s", name, strings.Join(names, ", "))
+}
+
+// templateConfig returns the configuration used to create an incident of the given type:
+// the same as the global one, except for the template of the document.
+func templateConfig(c *bot.Configuration, tpl *bot.IncidentTemplateConfig) *bot.Configuration {
+	if tpl == nil || tpl.DocTemplate == "" {
+		return c
+	}
+	conf := *c
+	conf.DocTemplate = tpl.DocTemplate
+	return &conf
+}
+
+// templateComponents adds the components of the type of incident to the given ones.
+func templateComponents(tpl *bot.IncidentTemplateConfig, components []string) []string {
+	if tpl == nil {
+		return components
+	}
+	all := append([]string{}, tpl.Components...)
+	for _, name := range components {
+		found := false
+		for _, existing := range all {
+			if strings.EqualFold(existing, name) {
+				found = true
+			}
+		}
+		if !found {
+			all = append(all, name)
+		}
+	}
+	return all
+}
+
+// postChecklist posts the checklist of the type of incident where the incident was started,
+// and in the dedicated channel of the incident, if any.
+func postChecklist(irc *hbot.Bot, m *hbot.Message, inc *Incident, tpl *bot.IncidentTemplateConfig) {
+	if tpl == nil || len(tpl.Checklist) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("Checklist for %s incidents:", tpl.Name)}
+	for n, step := range tpl.Checklist {
+		lines = append(lines, fmt.Sprintf("  %d. %s", n+1, step))
+	}
+	for _, line := range lines {
+		irc.Reply(m, line)
+		if inc.Channel != "" && inc.Channel != m.To {
+			irc.Msg(inc.Channel, line)
+		}
+	}
+}
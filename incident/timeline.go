@@ -0,0 +1,122 @@
+package incident
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kinds of events that can appear in the timeline of an incident.
+const (
+	EventStart       = "start"
+	EventSeverity    = "severity"
+	EventStatus      = "status"
+	EventDescription = "description"
+	EventRole        = "role"
+	EventReopen      = "reopen"
+	EventAlert       = "alert"
+	EventClose       = "close"
+	EventLog         = "log"
+	EventLink        = "link"
+	EventMerge       = "merge"
+	EventPage        = "page"
+	EventAck         = "ack"
+	EventComms       = "comms"
+	EventImpact      = "impact"
+	EventAction      = "action"
+)
+
+// Event is a single, timestamped entry in the timeline of an incident.
+type Event struct {
+	ID         int64
+	IncidentID int64
+	Kind       string
+	Author     string
+	CreatedAt  time.Time
+	Text       string
+}
+
+// String formats the event as a single line, suitable for IRC.
+func (e *Event) String() string {
+	humanTime := e.CreatedAt.Format("15:04 Jan 2 2006")
+	if e.Text == "" {
+		return fmt.Sprintf("[%s] %s by %s", humanTime, e.Kind, e.Author)
+	}
+	return fmt.Sprintf("[%s] %s by %s: %s", humanTime, e.Kind, e.Author, e.Text)
+}
+
+// Save persists the event to the database.
+func (e *Event) Save(db Querier) error {
+	statement, err := db.Prepare("INSERT INTO incident_events (incident_id, kind, author, created_at, text) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	result, err := statement.Exec(e.IncidentID, e.Kind, e.Author, e.CreatedAt.Format(time.RFC3339), e.Text)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// AddEvent appends a new event to the timeline of the incident.
+// The event will be persisted the next time the incident is saved.
+func (i *Incident) AddEvent(kind string, author string, text string) *Event {
+	e := &Event{
+		IncidentID: i.ID,
+		Kind:       kind,
+		Author:     author,
+		CreatedAt:  time.Now(),
+		Text:       text,
+	}
+	i.pendingEvents = append(i.pendingEvents, e)
+	return e
+}
+
+// Timeline returns all the events recorded for the incident, oldest first.
+func (i *Incident) Timeline(db Querier) ([]*Event, error) {
+	return GetTimeline(db, i.ID)
+}
+
+// GetTimeline fetches the timeline of an incident from the database, oldest first.
+func GetTimeline(db Querier, incidentID int64) ([]*Event, error) {
+	statement, err := db.Prepare("SELECT id, incident_id, kind, author, created_at, text FROM incident_events WHERE incident_id = ? ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statement.Query(incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []*Event
+	for rows.Next() {
+		e := Event{}
+		var created string
+		if err := rows.Scan(&e.ID, &e.IncidentID, &e.Kind, &e.Author, &created, &e.Text); err != nil {
+			return nil, err
+		}
+		if e.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// saveEvents persists all the events that were added to the incident
+// since it was last saved.
+func (i *Incident) saveEvents(db Querier) error {
+	for len(i.pendingEvents) > 0 {
+		e := i.pendingEvents[0]
+		e.IncidentID = i.ID
+		if err := e.Save(db); err != nil {
+			return err
+		}
+		// The event is saved: it must not be inserted again on the next save, even if it can't be queued.
+		i.pendingEvents = i.pendingEvents[1:]
+		if err := i.queueDocumentUpdate(db, e.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
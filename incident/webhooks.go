@@ -0,0 +1,59 @@
+package incident
+
+import "time"
+
+// Events sent to the webhooks
+const (
+	WebhookStart  = "start"
+	WebhookUpdate = "update"
+	WebhookClose  = "close"
+)
+
+// IncidentPayload is the JSON representation of an incident sent to the webhooks.
+type IncidentPayload struct {
+	ID          int64     `json:"id"`
+	Severity    int64     `json:"severity"`
+	Status      string    `json:"status"`
+	Components  []string  `json:"components"`
+	Description string    `json:"description"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	DocumentURL string    `json:"document_url,omitempty"`
+}
+
+// WebhookPayload is the body of the webhook requests.
+type WebhookPayload struct {
+	Event    string           `json:"event"`
+	Incident *IncidentPayload `json:"incident"`
+}
+
+// Payload returns the JSON-friendly representation of the incident.
+func (i *Incident) Payload() *IncidentPayload {
+	p := IncidentPayload{
+		ID:          i.ID,
+		Severity:    i.severity,
+		Status:      StatusName(i.Status),
+		Components:  i.components,
+		Description: i.Description,
+		StartedAt:   i.startedAt,
+		UpdatedAt:   i.updatedAt,
+	}
+	if i.Document != nil {
+		p.DocumentURL = i.Document.Url()
+	}
+	return &p
+}
+
+// webhookEvent tells which event saving the incident corresponds to.
+// It needs to be called before the incident is saved.
+func (i *Incident) webhookEvent() string {
+	if i.ID == 0 || i.unpublished {
+		return WebhookStart
+	}
+	for _, e := range i.pendingEvents {
+		if e.Kind == EventClose {
+			return WebhookClose
+		}
+	}
+	return WebhookUpdate
+}
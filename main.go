@@ -16,11 +16,16 @@ GNU General Public License for more details.
 */
 
 import (
+	"blabber/alertmanager"
 	"blabber/bot"
 	"blabber/contact"
 	"blabber/incident"
 	"blabber/triggers"
+	"blabber/web"
 	"flag"
+	"fmt"
+	"os"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	log "gopkg.in/inconshreveable/log15.v2"
@@ -28,29 +33,201 @@ import (
 
 var configFile = flag.String("config", "config.json", "Optional configuration file (JSON)")
 
+// authorize obtains the OAuth2 token for google docs interactively.
+// Usage: blabber [-config file] auth [-device]
+func authorize(conf *bot.Configuration, args []string) {
+	authFlags := flag.NewFlagSet("auth", flag.ExitOnError)
+	useDevice := authFlags.Bool("device", false, "Use the device flow instead of pasting the authorization code from the browser. Only documents created by blabber can be used then")
+	authFlags.Parse(args)
+	if *useDevice {
+		if err := incident.CheckDeviceFlow(conf); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if err := incident.GDriveConfig.Authorize(*useDevice); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Token saved to %s\n", incident.GDriveConfig.TokenFileName)
+}
+
+// exportIncidents writes the incidents to the standard output, or to a file.
+// Usage: blabber [-config file] export incidents [-since 90d] [-format json|csv] [-output file]
+func exportIncidents(conf *bot.Configuration, args []string) {
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	since := exportFlags.String("since", "", "Only export the incidents started since a date (2006-01-02), a number of days (90d) or a duration (12h)")
+	format := exportFlags.String("format", incident.FormatJSON, "Format of the export: json or csv")
+	output := exportFlags.String("output", "", "File to write the export to, instead of the standard output")
+	if len(args) == 0 || args[0] != "incidents" {
+		fmt.Println("Usage: blabber export incidents [-since 90d] [-format json|csv] [-output file]")
+		os.Exit(1)
+	}
+	exportFlags.Parse(args[1:])
+	var start time.Time
+	if *since != "" {
+		var err error
+		if start, err = incident.ParseSince(*since, time.Now()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	db, err := bot.OpenDB(conf.DbDsn)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	incidents, err := incident.ExportIncidents(db, start)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if err := incident.WriteExport(out, incidents, *format); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// importIncidents loads incidents exported by blabber, or by another tracker in the same format.
+// Usage: blabber [-config file] import incidents [-format json|csv] file
+func importIncidents(conf *bot.Configuration, args []string) {
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := importFlags.String("format", incident.FormatJSON, "Format of the file: json or csv")
+	if len(args) == 0 || args[0] != "incidents" {
+		fmt.Println("Usage: blabber import incidents [-format json|csv] file")
+		os.Exit(1)
+	}
+	importFlags.Parse(args[1:])
+	if importFlags.NArg() != 1 {
+		fmt.Println("Usage: blabber import incidents [-format json|csv] file")
+		os.Exit(1)
+	}
+	f, err := os.Open(importFlags.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	incidents, err := incident.ReadExport(f, *format)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	db, err := bot.OpenDB(conf.DbDsn)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	imported, skipped, err := incident.ImportIncidents(db, conf, incidents)
+	fmt.Printf("%d incidents imported, %d already imported before\n", imported, skipped)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	flag.Parse()
 	conf, err := bot.GetConfig(*configFile)
 	if err != nil {
 		log.Info("Could not open configuration file")
 	}
+	// Populate the google drive configuration
+	incident.GDriveConfig.CredentialsFileName = conf.AuthCredentials
+	incident.GDriveConfig.TokenFileName = conf.AuthToken
+	incident.GDriveConfig.ServiceAccountFileName = conf.AuthServiceAccount
+	incident.GDriveConfig.Subject = conf.AuthSubject
+	switch flag.Arg(0) {
+	case "auth":
+		authorize(conf, flag.Args()[1:])
+		return
+	case "export":
+		exportIncidents(conf, flag.Args()[1:])
+		return
+	case "import":
+		importIncidents(conf, flag.Args()[1:])
+		return
+	}
+	if err := incident.SetDocumentBackend(conf); err != nil {
+		panic(err)
+	}
 	bbot, err := bot.NewBot(conf)
 	if err != nil {
 		panic(err)
 	}
 	defer bbot.DB.Close()
-	// Populate the google drive configuration
-	incident.GDriveConfig.CredentialsFileName = conf.AuthCredentials
-	incident.GDriveConfig.TokenFileName = conf.AuthToken
+	if err := incident.ValidateEscalation(bbot.DB, conf); err != nil {
+		panic(err)
+	}
+	if err := incident.ValidateReminders(conf); err != nil {
+		panic(err)
+	}
+	if err := incident.BackfillSearchIndex(bbot.DB); err != nil {
+		log.Error("Could not index the incidents for search", "error", err)
+	}
+	// Join the dedicated channels of the open incidents too.
+	incidentChannels, err := incident.GetOpenChannels(bbot.DB)
+	if err != nil {
+		log.Error("Could not fetch the incident channels", "error", err)
+	}
+	bbot.Irc.Channels = append(append([]string{}, conf.Channels...), incidentChannels...)
 
 	registry := triggers.NewRegistry(conf, bbot.DB)
 	// Basic bot - does rickrolling and manages ACLs
 	registry.RegisterCommands(triggers.IrcCommands)
 	// Incident related - the first is a simple event handler with no command associated
 	registry.Register("store_topic", incident.StoreTopic, "")
+	registry.Register("capture_log", incident.CaptureLog, "")
 	registry.RegisterCommands(incident.IrcCommands)
+	// Incident roles can be used in ACLs, e.g. "@commander"
+	for _, role := range incident.Roles {
+		registry.RegisterRole(role, incident.RoleHolder(role))
+	}
 	// Contact list related
 	registry.RegisterCommands(contact.IrcCommands)
 	registry.AddAll(bbot)
+	// Retry the updates to the incident documents that failed.
+	go incident.SyncDocuments(bbot.DB, time.Minute)
+	// Announce the maintenance windows, and keep the topic up to date.
+	go incident.RunMaintenanceScheduler(bbot.Irc, bbot.DB, conf, time.Minute)
+	// Nag about the incidents that aren't updated, and post the daily digest.
+	go incident.NewReminders(bbot.Irc, bbot.DB, conf).Run(time.Minute)
+	// Page the next tier when nobody acknowledges a page.
+	go incident.RunEscalations(bbot.Irc, bbot.DB, conf, time.Minute)
+	// Embedded HTTP server
+	if conf.HTTPListen != "" {
+		server := web.NewServer(conf.HTTPListen)
+		if conf.StatusPage {
+			incident.RegisterStatusPage(server, bbot.DB, conf)
+		}
+		if conf.AtomFeed {
+			incident.RegisterFeed(server, bbot.DB, conf)
+		}
+		if conf.MaintenanceCalendar {
+			incident.RegisterMaintenanceCalendar(server, bbot.DB, conf)
+		}
+		if conf.Alertmanager.Enabled {
+			receiver, err := alertmanager.NewReceiver(bbot.Irc, bbot.DB, conf)
+			if err != nil {
+				panic(err)
+			}
+			receiver.Register(server)
+		}
+		go func() {
+			if err := server.Run(); err != nil {
+				log.Error("The HTTP server stopped", "error", err)
+			}
+		}()
+	}
 	bbot.Irc.Run()
 }
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// Types of notifiers.
+const (
+	TypeSMTP    = "smtp"
+	TypeHTTPSMS = "http_sms"
+)
+
+// ErrNoAddress is returned when the recipient can't be reached by a notifier,
+// e.g. a contact without an email address.
+var ErrNoAddress = errors.New("The recipient has no address for this notifier")
+
+// Recipient is someone to notify.
+type Recipient struct {
+	Name  string
+	Phone string
+	Email string
+}
+
+// Notifier sends messages to people.
+type Notifier interface {
+	Notify(to Recipient, subject string, message string) error
+}
+
+// New returns the notifier described by the configuration.
+func New(conf bot.NotifierConfig) (Notifier, error) {
+	switch conf.Type {
+	case TypeSMTP:
+		if conf.SMTPServer == "" || conf.From == "" {
+			return nil, fmt.Errorf("The smtp notifier needs smtp_server and from")
+		}
+		return &SMTPNotifier{conf}, nil
+	case TypeHTTPSMS:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("The http_sms notifier needs url")
+		}
+		return &HTTPSMSNotifier{conf}, nil
+	default:
+		return nil, fmt.Errorf("Unknown notifier type '%s'", conf.Type)
+	}
+}
+
+// SMTPNotifier sends emails.
+type SMTPNotifier struct {
+	conf bot.NotifierConfig
+}
+
+// Notify sends an email to the recipient.
+func (n *SMTPNotifier) Notify(to Recipient, subject string, message string) error {
+	if to.Email == "" {
+		return ErrNoAddress
+	}
+	var auth smtp.Auth
+	if n.conf.SMTPUsername != "" {
+		host := strings.Split(n.conf.SMTPServer, ":")[0]
+		auth = smtp.PlainAuth("", n.conf.SMTPUsername, n.conf.SMTPPassword, host)
+	}
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", n.conf.From, to.Email, subject, message)
+	if err := smtp.SendMail(n.conf.SMTPServer, auth, n.conf.From, []string{to.Email}, []byte(body)); err != nil {
+		return fmt.Errorf("Could not send the email to %s: %v", to.Email, err)
+	}
+	return nil
+}
+
+// HTTPSMSNotifier sends text messages through an HTTP gateway.
+type HTTPSMSNotifier struct {
+	conf bot.NotifierConfig
+}
+
+// Notify sends a text message to the recipient.
+func (n *HTTPSMSNotifier) Notify(to Recipient, subject string, message string) error {
+	if to.Phone == "" {
+		return ErrNoAddress
+	}
+	if err := web.PostJSON(n.conf.URL, n.conf.Token, map[string]string{"to": to.Phone, "message": message}, nil); err != nil {
+		return fmt.Errorf("Could not send the text message to %s: %v", to.Phone, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package publisher
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"blabber/webhook"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Types of publishers.
+const (
+	TypeHTTP    = "http"
+	TypeFile    = "file"
+	TypeWebhook = "webhook"
+)
+
+// WebhookEvent is the event sent to webhook publishers.
+const WebhookEvent = "comms"
+
+// Message is an approved communication about an incident.
+type Message struct {
+	IncidentID  int64     `json:"incident_id"`
+	Components  []string  `json:"components"`
+	Text        string    `json:"message"`
+	Author      string    `json:"author"`
+	ApprovedBy  string    `json:"approved_by"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Publisher pushes communications to the outside world.
+type Publisher interface {
+	Publish(msg *Message) error
+}
+
+// New returns the publisher described by the configuration.
+func New(conf bot.PublisherConfig) (Publisher, error) {
+	switch conf.Type {
+	case TypeHTTP:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("The http publisher needs url")
+		}
+		return &HTTPPublisher{conf}, nil
+	case TypeFile:
+		if conf.Path == "" {
+			return nil, fmt.Errorf("The file publisher needs path")
+		}
+		return &FilePublisher{conf}, nil
+	case TypeWebhook:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("The webhook publisher needs url")
+		}
+		return &WebhookPublisher{conf}, nil
+	default:
+		return nil, fmt.Errorf("Unknown publisher type '%s'", conf.Type)
+	}
+}
+
+// HTTPPublisher POSTs the message as JSON to the API of a status page.
+type HTTPPublisher struct {
+	conf bot.PublisherConfig
+}
+
+// Publish sends the message to the status page.
+func (p *HTTPPublisher) Publish(msg *Message) error {
+	if err := web.PostJSON(p.conf.URL, p.conf.Token, msg, nil); err != nil {
+		return fmt.Errorf("Could not publish to %s: %v", p.conf.URL, err)
+	}
+	return nil
+}
+
+// FilePublisher appends the message to a local file, e.g. one served by a static site.
+type FilePublisher struct {
+	conf bot.PublisherConfig
+}
+
+// Publish appends the message to the file.
+func (p *FilePublisher) Publish(msg *Message) error {
+	f, err := os.OpenFile(p.conf.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %v", p.conf.Path, err)
+	}
+	defer f.Close()
+	line := fmt.Sprintf("%s [%s] %s\n", msg.PublishedAt.Format("2006-01-02 15:04 MST"), strings.Join(msg.Components, ", "), msg.Text)
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("Could not write to %s: %v", p.conf.Path, err)
+	}
+	return nil
+}
+
+// WebhookPublisher sends the message like the other outgoing webhooks: signed, and retried in the background.
+type WebhookPublisher struct {
+	conf bot.PublisherConfig
+}
+
+// Publish fires the webhook.
+func (p *WebhookPublisher) Publish(msg *Message) error {
+	webhook.Fire([]bot.WebhookConfig{{URL: p.conf.URL, Secret: p.conf.Secret}}, WebhookEvent, msg)
+	return nil
+}
@@ -1,4 +1,17 @@
 CREATE TABLE contacts (`name` VARCHAR(256) PRIMARY KEY, `phone` VARCHAR(256), `email` VARCHAR(256));
 CREATE TABLE topics (`channel` VARCHAR(256) PRIMARY KEY, `topic` TEXT);
-CREATE TABLE incidents (`id` INTEGER PRIMARY KEY, `severity` INTEGER, `components` VARCHAR(256), `started_at` DATETIME, `updated_at` DATETIME, status INTEGER, description TEXT, `document_id` VARCHAR(256));
+CREATE TABLE incidents (`id` INTEGER PRIMARY KEY, `severity` INTEGER, `components` VARCHAR(256), `started_at` DATETIME, `updated_at` DATETIME, status INTEGER, description TEXT, `document_id` VARCHAR(256), `channel` VARCHAR(256), `impact` TEXT);
 CREATE TABLE acls (`command` VARCHAR(256), `identifier` VARCHAR(256), PRIMARY KEY (`command`, `identifier`));
+CREATE TABLE incident_events (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER, `kind` VARCHAR(64), `author` VARCHAR(256), `created_at` DATETIME, `text` TEXT);
+CREATE TABLE incident_roles (`incident_id` INTEGER, `role` VARCHAR(64), `nick` VARCHAR(256), `assigned_by` VARCHAR(256), `assigned_at` DATETIME);
+CREATE TABLE document_updates (`id` INTEGER PRIMARY KEY, `document_id` VARCHAR(256), `text` TEXT, `attempts` INTEGER, `created_at` DATETIME);
+CREATE TABLE incident_reports (`incident_id` INTEGER PRIMARY KEY, `document_id` VARCHAR(256), `path` VARCHAR(1024), `created_at` DATETIME);
+CREATE TABLE components (`name` VARCHAR(256) PRIMARY KEY, `aliases` VARCHAR(1024), `team` VARCHAR(256), `public` INTEGER);
+CREATE TABLE alert_incidents (`fingerprint` VARCHAR(256) PRIMARY KEY, `incident_id` INTEGER);
+CREATE TABLE maintenances (`id` INTEGER PRIMARY KEY, `starts_at` DATETIME, `ends_at` DATETIME, `components` VARCHAR(256), `description` TEXT, `author` VARCHAR(256), `state` INTEGER);
+CREATE VIRTUAL TABLE incident_search USING fts4(`components`, `description`, `timeline`);
+CREATE TABLE incident_links (`incident_id` INTEGER, `linked_id` INTEGER, `kind` VARCHAR(64), `created_by` VARCHAR(256), `created_at` DATETIME);
+CREATE TABLE incident_pages (`incident_id` INTEGER PRIMARY KEY, `tier` INTEGER, `paged_at` DATETIME, `acked_by` VARCHAR(256), `acked_at` DATETIME);
+CREATE TABLE incident_comms (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER, `text` TEXT, `author` VARCHAR(256), `created_at` DATETIME, `approved_by` VARCHAR(256), `approved_at` DATETIME, `published_at` DATETIME, `published_to` TEXT);
+CREATE TABLE incident_actions (`id` INTEGER PRIMARY KEY, `incident_id` INTEGER REFERENCES incidents(`id`), `number` INTEGER, `owner` VARCHAR(256), `text` TEXT, `created_by` VARCHAR(256), `created_at` DATETIME, `done_by` VARCHAR(256), `done_at` DATETIME, `task` VARCHAR(1024));
+CREATE TABLE imported_incidents (`source_id` INTEGER, `started_at` DATETIME, `incident_id` INTEGER, PRIMARY KEY (`source_id`, `started_at`));
@@ -0,0 +1,111 @@
+package tracker
+
+import (
+	"blabber/bot"
+	"blabber/web"
+	"encoding/json"
+	"fmt"
+)
+
+// Types of trackers.
+const (
+	TypeHTTP = "http"
+	TypeJira = "jira"
+)
+
+// Task is a follow-up of an incident, to be tracked in an issue tracker.
+type Task struct {
+	IncidentID  int64  `json:"incident_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Owner       string `json:"owner"`
+	Project     string `json:"project,omitempty"`
+}
+
+// Tracker creates tasks in an issue tracker.
+type Tracker interface {
+	// CreateTask creates the task, and returns a reference to it: its URL or its key.
+	CreateTask(task *Task) (string, error)
+}
+
+// New returns the tracker described by the configuration.
+func New(conf bot.TrackerConfig) (Tracker, error) {
+	switch conf.Type {
+	case TypeHTTP:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("The http tracker needs url")
+		}
+		return &HTTPTracker{conf}, nil
+	case TypeJira:
+		if conf.URL == "" || conf.Project == "" {
+			return nil, fmt.Errorf("The jira tracker needs url and project")
+		}
+		return &JiraTracker{conf}, nil
+	default:
+		return nil, fmt.Errorf("Unknown tracker type '%s'", conf.Type)
+	}
+}
+
+// post sends the task to the tracker, and decodes the JSON response.
+func post(conf bot.TrackerConfig, payload interface{}, response interface{}) error {
+	if err := web.PostJSON(conf.URL, conf.Token, payload, response); err != nil {
+		return fmt.Errorf("Could not create the task at %s: %v", conf.URL, err)
+	}
+	return nil
+}
+
+// HTTPTracker POSTs the task as JSON to a generic API, which answers with
+// the "id" of the new task and, optionally, its "url".
+type HTTPTracker struct {
+	conf bot.TrackerConfig
+}
+
+// CreateTask creates the task.
+func (t *HTTPTracker) CreateTask(task *Task) (string, error) {
+	payload := *task
+	payload.Project = t.conf.Project
+	var response struct {
+		ID  json.Number `json:"id"`
+		URL string      `json:"url"`
+	}
+	if err := post(t.conf, &payload, &response); err != nil {
+		return "", err
+	}
+	if response.URL != "" {
+		return response.URL, nil
+	}
+	if response.ID == "" {
+		return "", fmt.Errorf("The tracker at %s did not return the id of the task", t.conf.URL)
+	}
+	return response.ID.String(), nil
+}
+
+// JiraTracker creates issues with the Jira REST API. The URL is the one of the
+// issue endpoint, e.g. https://jira.example.org/rest/api/2/issue
+type JiraTracker struct {
+	conf bot.TrackerConfig
+}
+
+// CreateTask creates the issue, and returns its key.
+func (t *JiraTracker) CreateTask(task *Task) (string, error) {
+	// Assignees are Jira accounts, not IRC nicks: the owner goes in the description.
+	description := fmt.Sprintf("%s\n\nOwner: %s\nIncident: #%d", task.Description, task.Owner, task.IncidentID)
+	payload := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": t.conf.Project},
+			"summary":     task.Title,
+			"description": description,
+			"issuetype":   map[string]string{"name": "Task"},
+		},
+	}
+	var response struct {
+		Key string `json:"key"`
+	}
+	if err := post(t.conf, payload, &response); err != nil {
+		return "", err
+	}
+	if response.Key == "" {
+		return "", fmt.Errorf("Jira did not return the key of the issue")
+	}
+	return response.Key, nil
+}
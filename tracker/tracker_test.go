@@ -0,0 +1,71 @@
+package tracker
+
+import (
+	"blabber/bot"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateTask(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		switch r.URL.Path {
+		case "/url":
+			w.Write([]byte(`{"id": 12, "url": "https://tracker.example.org/12"}`))
+		case "/id":
+			w.Write([]byte(`{"id": 12}`))
+		case "/jira":
+			w.Write([]byte(`{"key": "OPS-12"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		name  string
+		conf  bot.TrackerConfig
+		want  string
+		valid bool
+	}{
+		{"http with url", bot.TrackerConfig{Type: TypeHTTP, URL: server.URL + "/url", Token: "token"}, "https://tracker.example.org/12", true},
+		{"http with id", bot.TrackerConfig{Type: TypeHTTP, URL: server.URL + "/id", Token: "token"}, "12", true},
+		{"http without id", bot.TrackerConfig{Type: TypeHTTP, URL: server.URL + "/none", Token: "token"}, "", false},
+		{"jira", bot.TrackerConfig{Type: TypeJira, URL: server.URL + "/jira", Token: "token", Project: "OPS"}, "OPS-12", true},
+		{"jira without key", bot.TrackerConfig{Type: TypeJira, URL: server.URL + "/none", Token: "token", Project: "OPS"}, "", false},
+		{"wrong token", bot.TrackerConfig{Type: TypeHTTP, URL: server.URL + "/url", Token: "other"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := New(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref, err := tr.CreateTask(&Task{IncidentID: 3, Title: "Fix the failover", Owner: "alice"})
+			if tt.valid != (err == nil) {
+				t.Fatalf("got error %v, want valid %t", err, tt.valid)
+			}
+			if ref != tt.want {
+				t.Errorf("got task %q, want %q", ref, tt.want)
+			}
+			if tt.valid && received == nil {
+				t.Error("the tracker received no task")
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, conf := range []bot.TrackerConfig{{Type: TypeHTTP}, {Type: TypeJira, URL: "https://jira.example.org"}, {Type: "trello", URL: "https://example.org"}} {
+		if _, err := New(conf); err == nil {
+			t.Errorf("New(%+v) should fail", conf)
+		}
+	}
+}
@@ -16,8 +16,13 @@ import (
 type commandACL struct {
 	nicks    map[string]bool
 	channels map[string]bool
+	roles    map[string]bool
 }
 
+// RoleResolver tells if the author of a message holds a role, given the
+// arguments passed to the command. Roles can be used in ACLs as "@role".
+type RoleResolver func(args []string, m *hbot.Message, db *sql.DB) bool
+
 func (acl *commandACL) IsAllowed(m *hbot.Message) bool {
 	// First check the nickname
 	if _, ok := acl.nicks[m.Name]; ok {
@@ -30,6 +35,16 @@ func (acl *commandACL) IsAllowed(m *hbot.Message) bool {
 	return false
 }
 
+// HasRole checks if the author of the message holds any of the roles allowed by the ACL.
+func (acl *commandACL) HasRole(args []string, m *hbot.Message, db *sql.DB, resolvers map[string]RoleResolver) bool {
+	for role := range acl.roles {
+		if resolver, ok := resolvers[role]; ok && resolver(args, m, db) {
+			return true
+		}
+	}
+	return false
+}
+
 // CRD operations on ACLs
 // GetACL returns a full commandACL that can be used in a command.
 func GetACL(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, error) {
@@ -40,6 +55,7 @@ func GetACL(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, error)
 		c.nicks[admin] = true
 	}
 	c.channels = make(map[string]bool, 0)
+	c.roles = make(map[string]bool, 0)
 	statement, err := db.Prepare("SELECT identifier FROM acls WHERE command = ?")
 	if err != nil {
 		return &c, err
@@ -57,6 +73,8 @@ func GetACL(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, error)
 		}
 		if strings.HasPrefix(identifier, "#") {
 			c.channels[identifier] = true
+		} else if strings.HasPrefix(identifier, "@") {
+			c.roles[strings.TrimPrefix(identifier, "@")] = true
 		} else {
 			c.nicks[identifier] = true
 		}
@@ -157,6 +175,10 @@ func readAcl(args []string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration
 	for channel := range myAcl.channels {
 		irc.Reply(m, fmt.Sprintf("\t%s", channel))
 	}
+	irc.Reply(m, "Roles:")
+	for role := range myAcl.roles {
+		irc.Reply(m, fmt.Sprintf("\t@%s", role))
+	}
 	return true
 }
 
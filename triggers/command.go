@@ -34,6 +34,8 @@ type Command struct {
 	Action          commandClosure
 	Db              *sql.DB
 	Configuration   *bot.Configuration
+	// Resolvers for the roles that can be used in ACLs
+	Roles map[string]RoleResolver
 }
 
 // NewCommand allows to declare a full-featured IRC command.
@@ -43,7 +45,8 @@ type Command struct {
 // Arguments:
 // name string  it
 // regexString string representing a regexp to match the command parameters, if any.
-//   Use subgroup matching with named parameters if you want an automatic pretty-print in the help
+//   Use subgroup matching with named parameters if you want an automatic pretty-print in the help.
+//   If all the parameters are optional, start the regexp with their separator, e.g. `(?:\s+(?P<since>\S+))?\s*$`
 // public bool indicating if this command can be called (and replied to) in public
 // private bool indication if this command can be called (and replied to) in private message
 // action a commandClosure function that describes the action to take.
@@ -59,6 +62,9 @@ func NewCommand(
 	var fullRegexp string
 	if regexString == "" {
 		fullRegexp = fmt.Sprintf(`\!(%s)\s*$`, name)
+	} else if strings.HasPrefix(regexString, `(?:\s+`) {
+		// The regexp provides the separator, as it's optional too.
+		fullRegexp = fmt.Sprintf("\\!%s%s", name, regexString)
 	} else {
 		fullRegexp = fmt.Sprintf("\\!%s\\s%s", name, regexString)
 	}
@@ -98,7 +104,7 @@ func (cmd Command) checkAcl(irc *hbot.Bot, m *hbot.Message) bool {
 		// We log the issue, but we don't stop admins from being able to perform commands.
 		log.Error("Couldn't fetch the ACLs", "error", err.Error())
 	}
-	if !acl.IsAllowed(m) {
+	if !acl.IsAllowed(m) && !cmd.hasRole(acl, m) {
 		irc.Reply(m, "You're not allowed to perform this action.")
 		return false
 	} else {
@@ -107,6 +113,15 @@ func (cmd Command) checkAcl(irc *hbot.Bot, m *hbot.Message) bool {
 
 }
 
+// Checks if the author of the message holds a role allowed to perform the command.
+func (cmd Command) hasRole(acl *commandACL, m *hbot.Message) bool {
+	matches := cmd.ArgumentsRegexp.FindStringSubmatch(m.Content)
+	if matches == nil {
+		return false
+	}
+	return acl.HasRole(matches[1:], m, cmd.Db, cmd.Roles)
+}
+
 func (cmd Command) doAction(irc *hbot.Bot, m *hbot.Message) bool {
 	// Validate the content of the string
 	matches := cmd.ArgumentsRegexp.FindStringSubmatch(m.Content)
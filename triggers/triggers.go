@@ -45,6 +45,8 @@ func (ev EvHandler) Help() string {
 type Registry struct {
 	// All the handlers, by ID
 	handlers map[string]HelpHandler
+	// Role resolvers, by role name
+	roles map[string]RoleResolver
 	// Configuration
 	config *bot.Configuration
 	// Database handle
@@ -55,6 +57,7 @@ type Registry struct {
 func NewRegistry(c *bot.Configuration, db *sql.DB) *Registry {
 	var r Registry
 	r.handlers = make(map[string]HelpHandler)
+	r.roles = make(map[string]RoleResolver)
 	r.config = c
 	r.db = db
 	return &r
@@ -83,6 +86,7 @@ func (r *Registry) RegisterCommand(command *Command) error {
 	id := command.ID
 	command.Db = r.db
 	command.Configuration = r.config
+	command.Roles = r.roles
 	if _, ok := r.handlers[id]; ok {
 		msg := fmt.Sprintf("Cannot register handler with id '%s' twice", id)
 		return errors.New(msg)
@@ -102,6 +106,15 @@ func (r *Registry) RegisterCommands(commands []*Command) error {
 	return nil
 }
 
+// RegisterRole allows to use "@role" as an identifier in the ACLs of any command.
+func (r *Registry) RegisterRole(role string, resolver RoleResolver) error {
+	if _, ok := r.roles[role]; ok {
+		return fmt.Errorf("Cannot register role '%s' twice", role)
+	}
+	r.roles[role] = resolver
+	return nil
+}
+
 // Deregister removes one handler from the system.
 func (r *Registry) Deregister(id string) {
 	delete(r.handlers, id)
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Client is the HTTP client used to call other services.
+var Client = &http.Client{Timeout: 10 * time.Second}
+
+// PostJSON sends the payload as JSON to the url, with the token as a bearer token if set.
+// If response is not nil, the JSON body of the response is decoded into it. Responses
+// without a 2xx status are errors.
+func PostJSON(url string, token string, payload interface{}, response interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if response != nil {
+		req.Header.Set("Accept", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the server returned %s", resp.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("could not parse the response: %v", err)
+	}
+	return nil
+}
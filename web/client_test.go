@@ -0,0 +1,63 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("Authorization") {
+		case "":
+			w.WriteHeader(http.StatusNoContent)
+		case "Bearer secret":
+			w.Write([]byte(`{"echo": "` + payload["text"] + `"}`))
+		case "Bearer garbage":
+			w.Write([]byte(`not json`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		name     string
+		token    string
+		response bool
+		want     string
+		valid    bool
+	}{
+		{"no response expected", "", false, "", true},
+		{"response", "secret", true, "hello", true},
+		{"response ignored", "secret", false, "", true},
+		{"error status", "wrong", true, "", false},
+		{"invalid response", "garbage", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Echo string `json:"echo"`
+			}
+			var target interface{}
+			if tt.response {
+				target = &response
+			}
+			err := PostJSON(server.URL, tt.token, map[string]string{"text": "hello"}, target)
+			if tt.valid != (err == nil) {
+				t.Fatalf("got error %v, want valid %t", err, tt.valid)
+			}
+			if response.Echo != tt.want {
+				t.Errorf("got response %q, want %q", response.Echo, tt.want)
+			}
+		})
+	}
+	if err := PostJSON("http://127.0.0.1:0/", "", nil, nil); err == nil {
+		t.Error("expected an error for an unreachable server")
+	}
+}
@@ -0,0 +1,31 @@
+package web
+
+import (
+	"net/http"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Server is an embedded HTTP server. Modules can add their own handlers to it
+// before it's started.
+type Server struct {
+	Addr string
+	mux  *http.ServeMux
+}
+
+// NewServer returns a new server that will listen on the given address.
+func NewServer(addr string) *Server {
+	return &Server{Addr: addr, mux: http.NewServeMux()}
+}
+
+// Handle registers the handler for the given pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	log.Info("Registering HTTP handler", "pattern", pattern)
+	s.mux.Handle(pattern, handler)
+}
+
+// Run starts serving requests. It only returns in case of errors.
+func (s *Server) Run() error {
+	log.Info("Starting the HTTP server", "address", s.Addr)
+	return http.ListenAndServe(s.Addr, s.mux)
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"blabber/bot"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// Headers added to every webhook request.
+const (
+	EventHeader     = "X-Blabber-Event"
+	SignatureHeader = "X-Blabber-Signature"
+)
+
+// Retry policy: the delay doubles after every failed attempt.
+const (
+	maxAttempts  = 6
+	initialDelay = 2 * time.Second
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Sign returns the hex-encoded HMAC-SHA256 signature of the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fire sends the payload as JSON to all the configured webhooks interested in the event.
+// Requests are sent in the background, and retried with exponential backoff.
+func Fire(hooks []bot.WebhookConfig, event string, payload interface{}) {
+	if len(hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("Could not encode the webhook payload", "event", event, "error", err)
+		return
+	}
+	for _, hook := range hooks {
+		if !wants(hook, event) {
+			continue
+		}
+		go deliver(hook, event, body)
+	}
+}
+
+// wants tells you if the webhook is subscribed to an event. No events means all of them.
+func wants(hook bot.WebhookConfig, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func deliver(hook bot.WebhookConfig, event string, body []byte) {
+	delay := initialDelay
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := post(hook, event, body)
+		if err == nil {
+			return
+		}
+		log.Error("Could not deliver the webhook", "url", hook.URL, "event", event, "attempt", attempt, "error", err)
+		if attempt < maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	log.Error("Giving up delivering the webhook", "url", hook.URL, "event", event)
+}
+
+func post(hook bot.WebhookConfig, event string, body []byte) error {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(hook.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	return nil
+}